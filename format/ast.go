@@ -0,0 +1,462 @@
+package format
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/token"
+)
+
+func mustPath(p *yaml.Path, err error) *yaml.Path {
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// CanonicalQuotes is a Rule that canonicalises quote usage in the
+// YAML source. If possible, the visitor will remove quotes, if this cannot
+// be done, it will try to use single quotes in place of double quotes.
+type CanonicalQuotes struct {
+	// root is the root node of the tree being walked.
+	root ast.Node
+}
+
+// Visitor returns the rule's visitor. It may be disabled by the "quotes"
+// directive.
+func (v CanonicalQuotes) Visitor(ctx *Context) ast.Visitor {
+	v.root = ctx.Root
+	return ctx.directed("quotes", v)
+}
+
+func (v CanonicalQuotes) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.StringNode:
+		if n.Token.Type != token.DoubleQuoteType && n.Token.Type != token.SingleQuoteType {
+			break
+		}
+		switch {
+		case canStripQuotes(n, v.root):
+			n.Token.Type = token.StringType
+		case canSingleQuote(n):
+			n.Token.Type = token.SingleQuoteType
+		}
+	}
+	return v
+}
+
+// canStripQuotes returns whether the token would be interpreted as a string
+// with the same value if it had its quotes removed and it contains no special
+// characters.
+func canStripQuotes(n *ast.StringNode, root ast.Node) (ok bool) {
+	if parent, ok := up(1, root, n).(*ast.MappingValueNode); ok && parent.Key == n {
+		if strings.ContainsAny(n.Token.Value, ` :{}[],&*#?|-<>=!%@\`+"\t\n") {
+			return false
+		}
+	}
+	tok := n.Token
+	if strings.TrimSpace(tok.Value) != tok.Value || hasPrefixAny(tok.Value, `:{}[],&*#?|-<>=!%@\`) {
+		return false
+	}
+	toks := lexer.Tokenize(tok.Value)
+	if len(toks) == 0 {
+		return false
+	}
+	return toks[0].Type == token.StringType && tok.Value == toks[0].Value
+}
+
+// hasPrefixAny returns whether s has a single rune prefix in chars. This
+// function is required because goccy/go-yaml does not completely interpret
+// field values.
+func hasPrefixAny(s, chars string) bool {
+	prefix, _ := utf8.DecodeRuneInString(s)
+	if prefix == utf8.RuneError {
+		return false
+	}
+	for _, r := range chars {
+		if prefix == r {
+			return true
+		}
+	}
+	return false
+}
+
+// canSingleQuote returns whether the string node would be interpreted as a string
+// with the same value if it had its double quotes replaced with single quotes.
+func canSingleQuote(n *ast.StringNode) (ok bool) {
+	if n.Token.Type == token.SingleQuoteType {
+		return false
+	}
+	new := *n
+	new.Token = token.SingleQuote(n.Token.Value, n.Token.Origin, n.Token.Position)
+	return stripQuotes(n.String()) == stripQuotes(new.String())
+}
+
+func stripQuotes(s string) string {
+	switch {
+	case len(s) < 2:
+		return s
+	case strings.HasPrefix(s, `'`) && strings.HasSuffix(s, `'`),
+		strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`):
+		return s[1 : len(s)-1]
+	default:
+		return s
+	}
+}
+
+// CanonicalOrder is a Rule that canonicalises the ordering of YAML
+// map fields. The ordering used is specified in the map by look-up of the
+// field YAML path to an ordering priority. The syntax uses an extension of
+// YAML path to allow priorities to be assigned to unrooted instances in the
+// YAML tree.
+//
+// Field sorting behaviour is defined by priority with lower value priority
+// fields being sorted before higher values. Negative priority values are
+// sorted last. Field paths without an assigned priority sort between
+// non-negative priorities and negative priorities. Ordering between fields
+// with the same priority value is resolved by lexical ordering.
+//
+// Example syntax:
+//
+// Sort used to order a changelog file keeping the version first, followed
+// by the changes map, with the ordering of each change starting with the
+// description, then type and link. All path are rooted ('$') and changes
+// are applied to all elements of each sequence ('[*]').
+//
+//  CanonicalOrder{
+//  	"$[*].version":                0,
+//  	"$[*].changes":                1,
+//  	"$[*].changes[*].description": 0,
+//  	"$[*].changes[*].type":        1,
+//  	"$[*].changes[*].link":        2,
+//  }
+//
+// Sort used to order a package manifest file. This configuration keeps the
+// owner field last and places all 'name' fields first, no matter the location
+// of the 'name' field by using the unrooted syntax ('*').
+//
+//  CanonicalOrder{
+//  	"*.name":        0,
+//  	"*.title":       1,
+//  	"$.version":     2,
+//  	"*.description": 3,
+//  	"$.owner":       -1,
+//  }
+//
+type CanonicalOrder map[string]int
+
+// Visitor returns the rule's visitor. It may be disabled by the "order"
+// directive.
+func (v CanonicalOrder) Visitor(ctx *Context) ast.Visitor {
+	return ctx.directed("order", v)
+}
+
+func (v CanonicalOrder) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		sort.Slice(n.Values, func(i, j int) bool {
+			pi := replaceIndices(n.Values[i].Key.GetPath())
+			pj := replaceIndices(n.Values[j].Key.GetPath())
+			return v.less(pi, pj)
+		})
+	}
+	return v
+}
+
+var indices = regexp.MustCompile(`\[[0-9]+\]`)
+
+func replaceIndices(s string) string {
+	return indices.ReplaceAllString(s, "[*]")
+}
+
+// less returns whether the mapping entry with the index-replaced path pi
+// sorts before the entry with path pj.
+func (v CanonicalOrder) less(pi, pj string) bool {
+	oi, oki := v.ordering(pi)
+	oj, okj := v.ordering(pj)
+	switch {
+	case oki && okj:
+		// We have a user defined ordering for the two.
+		if (oi < 0) == (oj < 0) {
+			// ith element sorts before the jth
+			// element by ordered comparison
+			// of their ordering value if they
+			// match signs, breaking ties lexically
+			// by path.
+			switch {
+			case oi < oj:
+				return true
+			case oi > oj:
+				return false
+			default:
+				return pi < pj
+			}
+		} else {
+			// Otherwise the ith element sorts first
+			// if it is non-negative.
+			return oi >= 0
+		}
+	case oki:
+		// Only the ith key has an ordering, so it sorts
+		// first unless it has a negative ordering.
+		return oi >= 0
+	case okj:
+		// Only the jth key has an ordering, so it sorts
+		// first unless it has a negative ordering.
+		return oj < 0
+	default:
+		// Fall back to lexical ordering.
+		return pi < pj
+	}
+}
+
+func (v CanonicalOrder) ordering(s string) (order int, ok bool) {
+	order, ok = v[s]
+	if ok {
+		return order, ok
+	}
+	for {
+		idx := strings.Index(s, ".")
+		if idx == -1 {
+			break
+		}
+		order, ok = v["*"+s[idx:]]
+		if ok {
+			return order, ok
+		}
+		s = s[idx+1:]
+	}
+	return 0, false
+}
+
+// SortLists is a Rule that canonicalises list ordering in the YAML
+// source. Because ordering of lists may be semantically laden sorting is
+// conditional.
+type SortLists struct {
+	// root is the root node of the tree being walked.
+	root ast.Node
+
+	// CanSort returns whether the node may be sorted
+	// according to the semantics of the YAML source.
+	CanSort func(root ast.Node, node *ast.SequenceNode) bool
+
+	// Less implements the list ordering to use.
+	Less func(a, b ast.Node) bool
+
+	// sorted, if not nil, is used to record the paths of
+	// sorted lists with indices replaced with "[*]".
+	sorted map[string]bool
+}
+
+// Visitor returns the rule's visitor. It may be disabled by the "sort"
+// directive.
+func (v SortLists) Visitor(ctx *Context) ast.Visitor {
+	v.root = ctx.Root
+	v.sorted = ctx.sortable
+	return ctx.directed("sort", v)
+}
+
+func (v SortLists) Visit(n ast.Node) ast.Visitor {
+	if v.Less == nil {
+		return nil
+	}
+	switch n := n.(type) {
+	case *ast.SequenceNode:
+		if v.CanSort == nil || v.CanSort(v.root, n) {
+			sortSequence(n, v.Less)
+			if v.sorted != nil {
+				v.sorted[replaceIndices(n.GetPath())] = true
+			}
+		}
+	}
+	return v
+}
+
+// sortSequence sorts the values of n according to less, keeping
+// comments associated with their values.
+func sortSequence(n *ast.SequenceNode, less func(a, b ast.Node) bool) {
+	if len(n.ValueComments) != len(n.Values) {
+		sort.Slice(n.Values, func(i, j int) bool {
+			return less(n.Values[i], n.Values[j])
+		})
+		return
+	}
+	sort.Sort(sequenceSorter{n: n, less: less})
+}
+
+// sequenceSorter implements sort.Interface for a sequence node with
+// value comments.
+type sequenceSorter struct {
+	n    *ast.SequenceNode
+	less func(a, b ast.Node) bool
+}
+
+func (s sequenceSorter) Len() int { return len(s.n.Values) }
+func (s sequenceSorter) Less(i, j int) bool {
+	return s.less(s.n.Values[i], s.n.Values[j])
+}
+func (s sequenceSorter) Swap(i, j int) {
+	s.n.Values[i], s.n.Values[j] = s.n.Values[j], s.n.Values[i]
+	s.n.ValueComments[i], s.n.ValueComments[j] = s.n.ValueComments[j], s.n.ValueComments[i]
+}
+
+// fixupVisitor is a Rule that works around failures in goccy/go-yaml
+// to correctly set indent of in-line JSON and associate comments in
+// mapping nodes. It is applied to every document before other rules.
+type fixupVisitor struct{}
+
+// Visitor returns the rule's visitor.
+func (v fixupVisitor) Visitor(*Context) ast.Visitor { return v }
+
+func (v fixupVisitor) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		// Fix comment associations. See https://github.com/goccy/go-yaml/issues/311.
+		if n.Comment != nil {
+			for _, c := range n.Values {
+				if c.Path == n.Comment.Path {
+					c.Comment = n.Comment
+					n.Comment = nil
+					break
+				}
+			}
+		}
+	case *ast.MappingValueNode:
+		// Fix in-line JSON indentation. See https://github.com/goccy/go-yaml/issues/324.
+		indent := n.GetToken().Position.IndentLevel
+		if n.Key.GetToken().Position.IndentLevel <= indent {
+			if n, ok := n.Key.(*ast.StringNode); ok {
+				n.Token.Position.IndentLevel = indent + 1
+			}
+		}
+	}
+	return v
+}
+
+// blankMarker is the value of the comment used to mark the position
+// of a blank line in the formatted source. It contains NUL bytes
+// so that it cannot collide with a comment in valid YAML source.
+const blankMarker = "\x00fumpt:blank\x00"
+
+// findBlankLines is an ast.Visitor that records the mapping entries
+// and sequence items in the YAML source that are preceded by a blank
+// line. Blank lines preceding the first entry or item of a block are
+// not recorded.
+type findBlankLines struct {
+	// blank is the set of blank line numbers in the source.
+	blank map[int]bool
+
+	// marked is the set of nodes preceded by a blank line.
+	marked map[ast.Node]bool
+}
+
+// newFindBlankLines returns a findBlankLines for the YAML source in src.
+func newFindBlankLines(src []byte) findBlankLines {
+	v := findBlankLines{
+		blank:  make(map[int]bool),
+		marked: make(map[ast.Node]bool),
+	}
+	for i, l := range strings.Split(string(src), "\n") {
+		if strings.TrimSpace(l) == "" {
+			v.blank[i+1] = true
+		}
+	}
+	return v
+}
+
+func (v findBlankLines) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		for _, e := range n.Values[min(1, len(n.Values)):] {
+			line := e.Key.GetToken().Position.Line
+			if e.Comment != nil {
+				line = e.Comment.GetToken().Position.Line
+			}
+			if v.blank[line-1] {
+				v.marked[e] = true
+			}
+		}
+	case *ast.SequenceNode:
+		for i := 1; i < len(n.Values); i++ {
+			line := n.Values[i].GetToken().Position.Line
+			if i < len(n.ValueComments) && n.ValueComments[i] != nil {
+				line = n.ValueComments[i].GetToken().Position.Line
+			}
+			if v.blank[line-1] {
+				v.marked[n.Values[i]] = true
+			}
+		}
+	}
+	return v
+}
+
+// markBlankLines is an ast.Visitor that inserts blank line marker
+// comments before the marked mapping entries and sequence items that
+// are not the first in their block. Markers are replaced with blank
+// lines in the formatted text by restoreBlankLines.
+type markBlankLines map[ast.Node]bool
+
+func (v markBlankLines) Visit(n ast.Node) ast.Visitor {
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		if n.IsFlowStyle {
+			break
+		}
+		for _, e := range n.Values[min(1, len(n.Values)):] {
+			if v[e] {
+				e.Comment = withBlankMarker(e.Comment, e.Key.GetToken().Position)
+			}
+		}
+	case *ast.SequenceNode:
+		if n.IsFlowStyle {
+			break
+		}
+		for len(n.ValueComments) < len(n.Values) {
+			n.ValueComments = append(n.ValueComments, nil)
+		}
+		for i := 1; i < len(n.Values); i++ {
+			if v[n.Values[i]] {
+				n.ValueComments[i] = withBlankMarker(n.ValueComments[i], n.Start.Position)
+			}
+		}
+	}
+	return v
+}
+
+// withBlankMarker returns the comment group c with a blank line marker
+// prepended.
+func withBlankMarker(c *ast.CommentGroupNode, pos *token.Position) *ast.CommentGroupNode {
+	marker := token.Comment(blankMarker, "#"+blankMarker, pos)
+	if c == nil {
+		return ast.CommentGroup([]*token.Token{marker})
+	}
+	c.Comments = append([]*ast.CommentNode{ast.Comment(marker)}, c.Comments...)
+	return c
+}
+
+// restoreBlankLines replaces the blank line marker comments in s with
+// blank lines.
+func restoreBlankLines(s string) string {
+	if !strings.Contains(s, blankMarker) {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "#"+blankMarker {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -1,4 +1,4 @@
-package main
+package format
 
 import (
 	"strings"
@@ -247,7 +247,7 @@ func TestCanonicalQuotes(t *testing.T) {
 				t.Fatalf("failed to parse document: %v", err)
 			}
 			for _, doc := range file.Docs {
-				ast.Walk(canonicalQuotes{root: doc}, doc)
+				ast.Walk(CanonicalQuotes{root: doc}, doc)
 			}
 			got := strings.TrimSpace(file.String())
 
@@ -261,13 +261,13 @@ func TestCanonicalQuotes(t *testing.T) {
 var canonicalOrderTests = []struct {
 	name  string
 	in    string
-	order canonicalOrder
+	order CanonicalOrder
 	want  string
 }{
 	{
 		name: "manifest",
 		in:   manifest,
-		order: canonicalOrder{
+		order: CanonicalOrder{
 			"$.name":        0,
 			"$.title":       1,
 			"$.version":     2,
@@ -294,7 +294,7 @@ owner:
 	{
 		name: "manifest_relaxed_spec",
 		in:   manifest,
-		order: canonicalOrder{
+		order: CanonicalOrder{
 			"*.name":        0,
 			"*.title":       1,
 			"$.version":     2,
@@ -321,7 +321,7 @@ owner:
 	{
 		name: "changelog_strict_spec",
 		in:   changelog,
-		order: canonicalOrder{
+		order: CanonicalOrder{
 			"$[*].version":                0,
 			"$[*].changes":                1,
 			"$[*].changes[*].description": 0, // *.description
@@ -346,7 +346,7 @@ owner:
 	{
 		name: "changelog_relaxed_spec",
 		in:   changelog,
-		order: canonicalOrder{
+		order: CanonicalOrder{
 			"*.version":     0,
 			"*.changes":     1,
 			"*.description": 0,
@@ -406,7 +406,7 @@ on_failure:
       field: error.message
       value: "{{ _ingest.on_failure_message }}"
 `,
-		order: canonicalOrder{
+		order: CanonicalOrder{
 			"*.description": 0,
 			"*.if":          1,
 			"*.field":       2,
@@ -447,6 +447,78 @@ on_failure:
       field: error.message
       value: "{{ _ingest.on_failure_message }}"`,
 	},
+	{
+		name: "pipeline_processors",
+		in: `---
+processors:
+  - grok:
+      tag: grok_message
+      pattern_definitions:
+        WORD: '\w+'
+      ignore_missing: true
+      patterns:
+        - '%{WORD:x}'
+      field: message
+  - date:
+      on_failure:
+        - remove:
+            field: x
+      target_field: '@timestamp'
+      timezone: UTC
+      formats:
+        - ISO8601
+      field: x
+      if: ctx.x != null
+  - foreach:
+      processor:
+        set:
+          value: v
+          ignore_failure: true
+          field: _ingest._value.y
+      field: list
+  - script:
+      source: ctx.y = 1
+      params: {}
+      description: Set y.
+      lang: painless
+      tag: script_y
+description: Pipeline with processor options`,
+		order: pipelineOrder,
+		want: `---
+description: Pipeline with processor options
+processors:
+  - grok:
+      field: message
+      patterns:
+        - '%{WORD:x}'
+      pattern_definitions:
+        WORD: '\w+'
+      ignore_missing: true
+      tag: grok_message
+  - date:
+      if: ctx.x != null
+      field: x
+      target_field: '@timestamp'
+      formats:
+        - ISO8601
+      timezone: UTC
+      on_failure:
+        - remove:
+            field: x
+  - foreach:
+      field: list
+      processor:
+        set:
+          field: _ingest._value.y
+          value: v
+          ignore_failure: true
+  - script:
+      description: Set y.
+      lang: painless
+      source: ctx.y = 1
+      params: {}
+      tag: script_y`,
+	},
 }
 
 func TestCanonicalOrder(t *testing.T) {
@@ -471,15 +543,15 @@ func TestCanonicalOrder(t *testing.T) {
 var sortListsTests = []struct {
 	name  string
 	in    string
-	order sortLists
+	order SortLists
 	want  string
 }{
 	{
 		name: "fields",
 		in:   fields,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `- name: cloud
   title: Cloud
@@ -510,9 +582,9 @@ var sortListsTests = []struct {
 	{
 		name: "fields_one_missing_name",
 		in:   fieldsOneMissingName,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `- name: cloud
   title: Cloud
@@ -542,9 +614,9 @@ var sortListsTests = []struct {
 	{
 		name: "fields_two_missing_names",
 		in:   fieldsTwoMissingNames,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `- name: cloud
   title: Cloud
@@ -583,9 +655,9 @@ var sortListsTests = []struct {
 - external: ecs
   name: event.created
 `,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `- external: ecs
   name: "@timestamp"
@@ -612,9 +684,9 @@ var sortListsTests = []struct {
   - external: ecs
     name: event.created
 `,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `fields:
   - external: ecs
@@ -643,9 +715,9 @@ var sortListsTests = []struct {
     - external: ecs
       name: event.created
 `,
-		order: sortLists{
-			canSort: isECSgroup,
-			less:    lessByName,
+		order: SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
 		},
 		want: `- name: fail
   fields:
@@ -879,3 +951,127 @@ func TestFixup(t *testing.T) {
 		})
 	}
 }
+
+var blankLinesTests = []struct {
+	name     string
+	in       string
+	visitors []Rule
+	want     string
+}{
+	{
+		name: "retain",
+		in: `a: 1
+
+b: 2
+c:
+  - x
+
+  - y
+`,
+		want: `a: 1
+
+b: 2
+c:
+  - x
+
+  - y
+`,
+	},
+	{
+		name: "canonicalise",
+		in: `a: 1
+
+
+
+b: 2
+`,
+		want: `a: 1
+
+b: 2
+`,
+	},
+	{
+		name: "leading",
+		in: `a:
+
+  b: 1
+  c: 2
+`,
+		want: `a:
+  b: 1
+  c: 2
+`,
+	},
+	{
+		name: "comment",
+		in: `a: 1
+
+# Comment for b.
+b: 2
+`,
+		want: `a: 1
+
+# Comment for b.
+b: 2
+`,
+	},
+	{
+		name:     "order",
+		visitors: []Rule{CanonicalOrder{"$.c": 0, "$.b": 1, "$.a": 2}},
+		in: `a: 1
+b: 2
+
+c: 3
+`,
+		want: `c: 3
+b: 2
+a: 1
+`,
+	},
+	{
+		name:     "order_travels",
+		visitors: []Rule{CanonicalOrder{"$.c": 0, "$.a": 1, "$.b": 2}},
+		in: `a: 1
+
+b: 2
+c: 3
+`,
+		want: `c: 3
+a: 1
+
+b: 2
+`,
+	},
+	{
+		name:     "sort_travels",
+		visitors: []Rule{SortLists{Less: LessByName}},
+		in: `- name: c
+- name: a
+
+# Comment for b.
+- name: b
+`,
+		want: `- name: a
+
+# Comment for b.
+- name: b
+- name: c
+`,
+	},
+}
+
+func TestBlankLines(t *testing.T) {
+	for _, test := range blankLinesTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(test.name, []byte(test.in), test.visitors)
+			if err != nil {
+				t.Fatalf("failed to apply changes: %v", err)
+			}
+			got = strings.TrimSpace(got)
+			want := strings.TrimSpace(test.want)
+			if got != want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+			}
+		})
+	}
+}
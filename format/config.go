@@ -0,0 +1,355 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// configName is the name of the project configuration file.
+const configName = ".fumpt.yml"
+
+// config is a project configuration. It is merged on top of the built-in
+// conventions to allow projects to add, override or disable file classes.
+//
+// Example configuration:
+//
+//	conventions:
+//	  # Order the owner field first in package manifests.
+//	  manifest.yml:
+//	    order:
+//	      $.owner: 0
+//	  # Do not format build files.
+//	  _dev/build/build.yml:
+//	    disable: true
+//	  # Add a class for sample events, sorting fields lists by name.
+//	  data_stream/*/sample_fields.yml:
+//	    order:
+//	      '*.name': 0
+//	    sort_lists:
+//	      by: name
+//	      when: always
+//	  # Expand embedded documents in dashboards for review.
+//	  kibana/dashboard/*.json:
+//	    embedded_json:
+//	      expand: true
+type config struct {
+	Conventions map[string]classConfig `yaml:"conventions"`
+}
+
+// classConfig is the configuration for a file class.
+type classConfig struct {
+	// Disable removes the file class from the conventions.
+	Disable bool `yaml:"disable"`
+
+	// Quotes is the quote policy for the class, either
+	// "canonical" or "preserve". The default is "canonical".
+	Quotes string `yaml:"quotes"`
+
+	// Order is the set of CanonicalOrder priorities for
+	// the class. Priorities are merged with the built-in
+	// priorities for the class.
+	Order map[string]int `yaml:"order"`
+
+	// SortLists is the list sorting configuration for the
+	// class.
+	SortLists *sortConfig `yaml:"sort_lists"`
+
+	// EmbeddedJSON is the embedded JSON document
+	// configuration for the class.
+	EmbeddedJSON *embeddedConfig `yaml:"embedded_json"`
+}
+
+// sortConfig is the configuration for list sorting.
+type sortConfig struct {
+	// Disable removes list sorting from the class.
+	Disable bool `yaml:"disable"`
+
+	// By is the sort key. The only valid key is "name".
+	By string `yaml:"by"`
+
+	// When is the condition under which lists are sorted,
+	// either "always" or "group" to only sort the lists
+	// of 'type: group' fields. The default is "group".
+	When string `yaml:"when"`
+}
+
+// embeddedConfig is the configuration for embedded JSON documents.
+type embeddedConfig struct {
+	// Disable removes embedded JSON formatting from
+	// the class.
+	Disable bool `yaml:"disable"`
+
+	// Keys is the set of names of members holding
+	// embedded documents. If empty, the built-in
+	// names for the class are used.
+	Keys []string `yaml:"keys"`
+
+	// Sort is whether the members of objects in
+	// embedded documents are sorted.
+	Sort *bool `yaml:"sort"`
+
+	// Expand is whether embedded documents are
+	// expanded in place rather than encoded as
+	// strings.
+	Expand *bool `yaml:"expand"`
+}
+
+var (
+	sortKeys = map[string]func(a, b ast.Node) bool{
+		"name": LessByName,
+	}
+	sortConditions = map[string]func(root ast.Node, n *ast.SequenceNode) bool{
+		"always": nil,
+		"group":  IsECSGroup,
+	}
+)
+
+// loadConventions returns the conventions for the package rooted at root.
+// The built-in conventions in base are merged with the nearest project
+// configuration file found in root or its parents, up to the root of the
+// repository containing the package. The returned conventions may be
+// altered without affecting base.
+func loadConventions(root string, base map[string][]Rule) (map[string][]Rule, error) {
+	path, err := findConfig(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config{}.merge(base)
+		}
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	err = yaml.UnmarshalWithOptions(b, &cfg, yaml.Strict())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	rules, err := cfg.merge(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// findConfig returns the path to the nearest project configuration file
+// in dir or its parents, stopping at the repository root. If no file is
+// found, os.ErrNotExist is returned.
+func findConfig(dir string) (string, error) {
+	d, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		p := filepath.Join(d, configName)
+		_, err := os.Stat(p)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		_, err = os.Stat(filepath.Join(d, ".git"))
+		if err == nil {
+			// We are at the repository root.
+			return "", os.ErrNotExist
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", os.ErrNotExist
+		}
+		d = parent
+	}
+}
+
+// merge returns the result of merging the configuration with the
+// conventions in base. base is not altered.
+func (c config) merge(base map[string][]Rule) (map[string][]Rule, error) {
+	rules := make(map[string][]Rule, len(base))
+	for class, classRules := range base {
+		rules[class] = classRules
+	}
+	for class, cfg := range c.Conventions {
+		if cfg.Disable {
+			delete(rules, class)
+			continue
+		}
+		classRules, err := cfg.apply(rules[class])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", class, err)
+		}
+		rules[class] = classRules
+	}
+	return rules, nil
+}
+
+// apply returns the result of applying the class configuration to the
+// rules in base. base is not altered.
+func (c classConfig) apply(base []Rule) ([]Rule, error) {
+	var (
+		quotes   = len(base) == 0
+		order    CanonicalOrder
+		lists    *SortLists
+		embedded *EmbeddedJSON
+	)
+	for _, v := range base {
+		switch v := v.(type) {
+		case CanonicalQuotes:
+			quotes = true
+		case CanonicalOrder:
+			order = v
+		case SortLists:
+			lists = &v
+		case EmbeddedJSON:
+			embedded = &v
+		}
+	}
+
+	switch c.Quotes {
+	case "":
+	case "canonical":
+		quotes = true
+	case "preserve":
+		quotes = false
+	default:
+		return nil, fmt.Errorf("invalid quote policy: %q", c.Quotes)
+	}
+
+	if len(c.Order) != 0 {
+		merged := make(CanonicalOrder, len(order)+len(c.Order))
+		for p, o := range order {
+			merged[p] = o
+		}
+		for p, o := range c.Order {
+			merged[p] = o
+		}
+		order = merged
+	}
+
+	if c.SortLists != nil {
+		if c.SortLists.Disable {
+			lists = nil
+		} else {
+			by := c.SortLists.By
+			if by == "" {
+				by = "name"
+			}
+			less, ok := sortKeys[by]
+			if !ok {
+				return nil, fmt.Errorf("invalid sort key: %q", by)
+			}
+			when := c.SortLists.When
+			if when == "" {
+				when = "group"
+			}
+			canSort, ok := sortConditions[when]
+			if !ok {
+				return nil, fmt.Errorf("invalid sort condition: %q", when)
+			}
+			lists = &SortLists{CanSort: canSort, Less: less}
+		}
+	}
+
+	if c.EmbeddedJSON != nil {
+		if c.EmbeddedJSON.Disable {
+			embedded = nil
+		} else {
+			e := EmbeddedJSON{}
+			if embedded != nil {
+				e = *embedded
+			}
+			if len(c.EmbeddedJSON.Keys) != 0 {
+				e.Keys = c.EmbeddedJSON.Keys
+			}
+			if len(e.Keys) == 0 {
+				return nil, errors.New("no embedded JSON keys")
+			}
+			if c.EmbeddedJSON.Sort != nil {
+				e.Sort = *c.EmbeddedJSON.Sort
+			}
+			if c.EmbeddedJSON.Expand != nil {
+				e.Expand = *c.EmbeddedJSON.Expand
+			}
+			embedded = &e
+		}
+	}
+
+	// Configured rules replace those of the same kind in base,
+	// or are removed if disabled. Rules that are not configurable
+	// keep their positions, and configured rules that are not in
+	// base are placed before any configurable rule following them
+	// in canonical order.
+	configured := make([]Rule, numConfigurable)
+	if quotes {
+		configured[configQuotes] = CanonicalQuotes{}
+	}
+	if embedded != nil {
+		configured[configEmbedded] = *embedded
+	}
+	if order != nil {
+		configured[configOrder] = order
+	}
+	if lists != nil {
+		configured[configLists] = *lists
+	}
+	placed := make([]bool, numConfigurable)
+	var classRules []Rule
+	for _, r := range base {
+		k := configurable(r)
+		switch {
+		case k < 0:
+			classRules = append(classRules, r)
+		case configured[k] != nil && !placed[k]:
+			classRules = append(classRules, configured[k])
+			placed[k] = true
+		}
+	}
+	for k, r := range configured {
+		if r == nil || placed[k] {
+			continue
+		}
+		i := len(classRules)
+		for j, c := range classRules {
+			if configurable(c) > k {
+				i = j
+				break
+			}
+		}
+		classRules = append(classRules[:i], append([]Rule{r}, classRules[i:]...)...)
+	}
+	return classRules, nil
+}
+
+// Kinds of configurable rules in canonical order.
+const (
+	configQuotes = iota
+	configEmbedded
+	configOrder
+	configLists
+	numConfigurable
+)
+
+// configurable returns the kind of the configurable rule r, or -1 if r
+// is not configurable.
+func configurable(r Rule) int {
+	switch r.(type) {
+	case CanonicalQuotes:
+		return configQuotes
+	case EmbeddedJSON:
+		return configEmbedded
+	case CanonicalOrder:
+		return configOrder
+	case SortLists:
+		return configLists
+	}
+	return -1
+}
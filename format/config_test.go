@@ -0,0 +1,190 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testConfig = `conventions:
+  manifest.yml:
+    quotes: preserve
+    order:
+      $.owner: 0
+      $.format_version: 1
+  _dev/build/build.yml:
+    disable: true
+  data_stream/*/fields/*.yml:
+    sort_lists:
+      disable: true
+  data_stream/*/sample_fields.yml:
+    order:
+      '*.name': 0
+    sort_lists:
+      when: always
+  kibana/dashboard/*.json:
+    embedded_json:
+      expand: true
+`
+
+func TestLoadConventions(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, ".git"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to make repository root: %v", err)
+	}
+	pkg := filepath.Join(dir, "packages", "pkg")
+	err = os.MkdirAll(pkg, 0o755)
+	if err != nil {
+		t.Fatalf("failed to make package root: %v", err)
+	}
+
+	rules, err := loadConventions(pkg, Conventions)
+	if err != nil {
+		t.Fatalf("unexpected error loading conventions without config: %v", err)
+	}
+	if len(rules) != len(Conventions) {
+		t.Errorf("unexpected number of classes without config: got:%d want:%d", len(rules), len(Conventions))
+	}
+
+	err = os.WriteFile(filepath.Join(dir, configName), []byte(testConfig), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	rules, err = loadConventions(pkg, Conventions)
+	if err != nil {
+		t.Fatalf("unexpected error loading conventions: %v", err)
+	}
+
+	if _, ok := rules["_dev/build/build.yml"]; ok {
+		t.Error("expected build class to be disabled")
+	}
+	if _, ok := Conventions["_dev/build/build.yml"]; !ok {
+		t.Error("unexpected mutation of built-in conventions")
+	}
+
+	manifest := rules["manifest.yml"]
+	if len(manifest) != 1 {
+		t.Fatalf("unexpected manifest visitors: %#v", manifest)
+	}
+	order, ok := manifest[0].(CanonicalOrder)
+	if !ok {
+		t.Fatalf("unexpected manifest visitor type: %T", manifest[0])
+	}
+	for path, want := range map[string]int{
+		"$.owner":          0,
+		"$.format_version": 1,
+		"*.name":           0,
+		"$.version":        2,
+	} {
+		if got, ok := order[path]; !ok || got != want {
+			t.Errorf("unexpected manifest priority for %s: got:%d want:%d", path, got, want)
+		}
+	}
+	if Conventions["manifest.yml"][1].(CanonicalOrder)["$.owner"] != -1 {
+		t.Error("unexpected mutation of built-in manifest priorities")
+	}
+
+	for _, v := range rules["data_stream/*/fields/*.yml"] {
+		if _, ok := v.(SortLists); ok {
+			t.Error("expected fields list sorting to be disabled")
+		}
+	}
+
+	sample := rules["data_stream/*/sample_fields.yml"]
+	if len(sample) != 3 {
+		t.Fatalf("unexpected sample visitors: %#v", sample)
+	}
+	if _, ok := sample[0].(CanonicalQuotes); !ok {
+		t.Errorf("expected canonical quotes for new class: %T", sample[0])
+	}
+	lists, ok := sample[2].(SortLists)
+	if !ok {
+		t.Fatalf("unexpected sample visitor type: %T", sample[2])
+	}
+	if lists.CanSort != nil || lists.Less == nil {
+		t.Error("unexpected sample list sorting configuration")
+	}
+
+	dashboard := rules["kibana/dashboard/*.json"]
+	if len(dashboard) != 2 {
+		t.Fatalf("unexpected dashboard visitors: %#v", dashboard)
+	}
+	embedded, ok := dashboard[0].(EmbeddedJSON)
+	if !ok {
+		t.Fatalf("unexpected dashboard visitor type: %T", dashboard[0])
+	}
+	if !embedded.Expand || !embedded.Sort || len(embedded.Keys) != len(KibanaKeys) {
+		t.Errorf("unexpected dashboard embedded JSON configuration: %#v", embedded)
+	}
+	if Conventions["kibana/dashboard/*.json"][0].(EmbeddedJSON).Expand {
+		t.Error("unexpected mutation of built-in dashboard configuration")
+	}
+}
+
+func TestLoadConventionsInvalid(t *testing.T) {
+	for _, cfg := range []string{
+		"conventions:\n  manifest.yml:\n    quotes: double\n",
+		"conventions:\n  manifest.yml:\n    sort_lists:\n      by: title\n",
+		"conventions:\n  manifest.yml:\n    unknown: true\n",
+		"conventions:\n  manifest.yml:\n    embedded_json:\n      sort: true\n",
+	} {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, configName), []byte(cfg), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		_, err = loadConventions(dir, map[string][]Rule{})
+		if err == nil {
+			t.Errorf("expected error for config:\n%s", cfg)
+		}
+	}
+}
+
+func TestClassConfigApplyKeepsRules(t *testing.T) {
+	base := []Rule{CanonicalQuotes{}, stripAllQuotes{}, CanonicalOrder{"$.a": 0}}
+	for _, test := range []struct {
+		name string
+		cfg  classConfig
+		want []string
+	}{
+		{
+			name: "unchanged",
+			want: []string{"CanonicalQuotes", "stripAllQuotes", "CanonicalOrder"},
+		},
+		{
+			name: "replace",
+			cfg:  classConfig{Order: map[string]int{"$.b": 1}},
+			want: []string{"CanonicalQuotes", "stripAllQuotes", "CanonicalOrder"},
+		},
+		{
+			name: "remove",
+			cfg:  classConfig{Quotes: "preserve"},
+			want: []string{"stripAllQuotes", "CanonicalOrder"},
+		},
+		{
+			name: "add",
+			cfg:  classConfig{SortLists: &sortConfig{}, EmbeddedJSON: &embeddedConfig{Keys: []string{"doc"}}},
+			want: []string{"CanonicalQuotes", "stripAllQuotes", "EmbeddedJSON", "CanonicalOrder", "SortLists"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := test.cfg.apply(base)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, r := range rules {
+				got = append(got, ruleName(r))
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+		})
+	}
+	if len(base) != 3 {
+		t.Errorf("unexpected mutation of base rules: %#v", base)
+	}
+}
@@ -0,0 +1,175 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+// in a unified diff.
+const diffContext = 3
+
+// unifiedDiff returns a unified diff of the old and new text labelled
+// with oldName and newName. If old and new are identical, nil is returned.
+func unifiedDiff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	edits := lineEdits(splitLines(string(old)), splitLines(string(new)))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(edits); {
+		// Find the next change.
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Extend the hunk until there is a run of unchanged lines
+		// long enough to separate it from the next change.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end += diffContext
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		oldLine, newLine := edits[start].oldLine, edits[start].newLine
+		var oldLen, newLen int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldLen++
+			}
+			if e.op != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(oldLine, oldLen), hunkRange(newLine, newLen))
+		for _, e := range edits[start:end] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// hunkRange returns the range notation for a hunk header starting at
+// the zero-based line with n lines.
+func hunkRange(line, n int) string {
+	switch n {
+	case 0:
+		// Empty ranges refer to the line before the change.
+		return fmt.Sprintf("%d,0", line)
+	case 1:
+		return fmt.Sprint(line + 1)
+	}
+	return fmt.Sprintf("%d,%d", line+1, n)
+}
+
+// splitLines splits s into lines retaining line endings.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edit is a single line operation in an edit script.
+type edit struct {
+	op      byte // ' ' for unchanged, '-' for deletion and '+' for insertion.
+	text    string
+	oldLine int // zero-based line number in the old text.
+	newLine int // zero-based line number in the new text.
+}
+
+// lineEdits returns a minimal edit script transforming a into b using
+// the Myers difference algorithm.
+func lineEdits(a, b []string) []edit {
+	n, m := len(a), len(b)
+
+	// trace holds the furthest reaching x for each diagonal k
+	// prior to each step d, indexed by k+d.
+	var trace [][]int
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Backtrack through the trace to recover the edit script.
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{op: ' ', text: a[x], oldLine: x, newLine: y})
+		}
+		if x == prevX {
+			y--
+			edits = append(edits, edit{op: '+', text: b[y], oldLine: x, newLine: y})
+		} else {
+			x--
+			edits = append(edits, edit{op: '-', text: a[x], oldLine: x, newLine: y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, edit{op: ' ', text: a[x], oldLine: x, newLine: y})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
@@ -0,0 +1,95 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var unifiedDiffTests = []struct {
+	name string
+	old  string
+	new  string
+	want string
+}{
+	{
+		name: "identical",
+		old:  "a\nb\n",
+		new:  "a\nb\n",
+		want: "",
+	},
+	{
+		name: "insert_into_empty",
+		old:  "",
+		new:  "a\n",
+		want: `--- old
++++ new
+@@ -0,0 +1 @@
++a
+`,
+	},
+	{
+		name: "two_hunks",
+		old:  "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+		new:  "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn",
+		want: `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+\ No newline at end of file
+`,
+	},
+	{
+		name: "merged_hunks",
+		old:  "a\nb\nc\nd\ne\nf\ng\nh\n",
+		new:  "A\nb\nc\nd\ne\nf\ng\nH\n",
+		want: `--- old
++++ new
+@@ -1,8 +1,8 @@
+-a
++A
+ b
+ c
+ d
+ e
+ f
+ g
+-h
++H
+`,
+	},
+	{
+		name: "move",
+		old:  "service: a\nnotify: b\ninput: c\n",
+		new:  "service: a\ninput: c\nnotify: b\n",
+		want: `--- old
++++ new
+@@ -1,3 +1,3 @@
+ service: a
+-notify: b
+ input: c
++notify: b
+`,
+	},
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, test := range unifiedDiffTests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(unifiedDiff("old", []byte(test.old), "new", []byte(test.new)))
+			if got != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
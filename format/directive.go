@@ -0,0 +1,223 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+)
+
+// directivePrefix is the prefix of comments that are formatting directives.
+const directivePrefix = "fumpt:"
+
+// directiveRules is the set of formatting rules that may be disabled
+// by directives.
+var directiveRules = map[string]bool{
+	"quotes": true,
+	"order":  true,
+	"sort":   true,
+}
+
+// directives is an ast.Visitor that collects the formatting rules disabled
+// by comment directives in the YAML source. Directives are comments on the
+// lines preceding a mapping entry or sequence item.
+//
+// A "# fumpt:ignore" directive disables all formatting rules within the
+// entry or item that it precedes. The disabled rules may be restricted by
+// naming them, for example "# fumpt:ignore order sort". The rule names are
+// "quotes" for CanonicalQuotes, "order" for CanonicalOrder and "sort" for
+// SortLists. An ignored entry or item may still be moved within its parent.
+//
+// A "# fumpt:off" directive disables all formatting rules for the entry or
+// item that it precedes and all following entries or items in the same
+// mapping or sequence up to one preceded by a "# fumpt:on" directive. The
+// entries of a mapping or sequence containing a disabled region are not
+// reordered.
+type directives struct {
+	// skip is the set of rules disabled for
+	// each node and its descendants.
+	skip map[ast.Node]map[string]bool
+
+	// pinned is the set of mapping and sequence
+	// nodes whose entries must not be reordered.
+	pinned map[ast.Node]bool
+
+	// keepLast maps mapping nodes to the entry
+	// that must remain last when the mapping is
+	// reordered.
+	keepLast map[*ast.MappingNode]*ast.MappingValueNode
+
+	// err is the first invalid directive found.
+	err error
+}
+
+// findDirectives returns the directives in the document rooted at root.
+func findDirectives(root ast.Node) (*directives, error) {
+	d := &directives{
+		skip:     make(map[ast.Node]map[string]bool),
+		pinned:   make(map[ast.Node]bool),
+		keepLast: make(map[*ast.MappingNode]*ast.MappingValueNode),
+	}
+	ast.Walk(d, root)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d, nil
+}
+
+func (d *directives) Visit(n ast.Node) ast.Visitor {
+	if d.err != nil {
+		return nil
+	}
+	switch n := n.(type) {
+	case *ast.MappingNode:
+		entries := make([]ast.Node, len(n.Values))
+		comments := make([]*ast.CommentGroupNode, len(n.Values))
+		for i, e := range n.Values {
+			entries[i] = e
+			comments[i] = e.Comment
+		}
+		d.scan(n, entries, comments)
+	case *ast.MappingValueNode:
+		// Single entry mappings are not held in a mapping node.
+		d.scan(nil, []ast.Node{n}, []*ast.CommentGroupNode{n.Comment})
+	case *ast.SequenceNode:
+		comments := make([]*ast.CommentGroupNode, len(n.Values))
+		copy(comments, n.ValueComments)
+		if len(comments) != 0 && comments[0] == nil {
+			// The comment preceding the first item
+			// is held by the sequence.
+			comments[0] = n.Comment
+		}
+		d.scan(n, n.Values, comments)
+	}
+	return d
+}
+
+// scan records the directives in the comments preceding each of the
+// entries of the mapping or sequence node parent.
+func (d *directives) scan(parent ast.Node, entries []ast.Node, comments []*ast.CommentGroupNode) {
+	var off bool
+	for i, e := range entries {
+		if comments[i] == nil && !off {
+			continue
+		}
+		var ignore map[string]bool
+		if comments[i] != nil {
+			for _, c := range comments[i].Comments {
+				verb, rules, err := parseDirective(c)
+				if err != nil {
+					d.err = err
+					return
+				}
+				switch verb {
+				case "off":
+					off = true
+				case "on":
+					off = false
+				case "ignore":
+					if ignore == nil {
+						ignore = make(map[string]bool)
+					}
+					for _, r := range rules {
+						ignore[r] = true
+					}
+				}
+			}
+		}
+		if off {
+			ignore = directiveRules
+			if parent != nil {
+				d.pinned[parent] = true
+			}
+		}
+		for r := range ignore {
+			d.disable(e, r)
+		}
+	}
+}
+
+// disable disables the named rule for n and its descendants.
+func (d *directives) disable(n ast.Node, rule string) {
+	skip := d.skip[n]
+	if skip == nil {
+		skip = make(map[string]bool)
+		d.skip[n] = skip
+	}
+	skip[rule] = true
+}
+
+// parseDirective returns the directive verb and the rules it applies to
+// for the comment c. If c is not a directive, verb is empty.
+func parseDirective(c *ast.CommentNode) (verb string, rules []string, err error) {
+	text := strings.TrimSpace(strings.TrimPrefix(c.Token.Value, "#"))
+	if !strings.HasPrefix(text, directivePrefix) {
+		return "", nil, nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, directivePrefix))
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("invalid directive %q at line %d", text, c.Token.Position.Line)
+	}
+	verb, rules = fields[0], fields[1:]
+	switch verb {
+	case "off", "on":
+		if len(rules) != 0 {
+			return "", nil, fmt.Errorf("invalid directive %q at line %d: %s takes no rules", text, c.Token.Position.Line, verb)
+		}
+	case "ignore":
+		if len(rules) == 0 {
+			for r := range directiveRules {
+				rules = append(rules, r)
+			}
+		}
+		for _, r := range rules {
+			if !directiveRules[r] {
+				return "", nil, fmt.Errorf("invalid directive %q at line %d: unknown rule %q", text, c.Token.Position.Line, r)
+			}
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid directive %q at line %d", text, c.Token.Position.Line)
+	}
+	return verb, rules, nil
+}
+
+// directed is an ast.Visitor that applies the formatting rule visitor v
+// except where the rule is disabled by directives.
+type directed struct {
+	rule       string
+	v          ast.Visitor
+	directives *directives
+}
+
+func (v directed) Visit(n ast.Node) ast.Visitor {
+	if v.directives.skip[n][v.rule] {
+		return nil
+	}
+	if v.directives.pinned[n] {
+		// Continue into the entries without
+		// reordering them.
+		return v
+	}
+	w := v.v.Visit(n)
+	if n, ok := n.(*ast.MappingNode); ok {
+		if last, ok := v.directives.keepLast[n]; ok {
+			moveLast(n, last)
+		}
+	}
+	if w == nil {
+		return nil
+	}
+	v.v = w
+	return v
+}
+
+// moveLast moves the entry e of n to the end of its entries.
+func moveLast(n *ast.MappingNode, e *ast.MappingValueNode) {
+	for i, v := range n.Values {
+		if v == e {
+			copy(n.Values[i:], n.Values[i+1:])
+			n.Values[len(n.Values)-1] = e
+			return
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var directiveTests = []struct {
+	name    string
+	in      string
+	want    string
+	wantErr string
+}{
+	{
+		name: "none",
+		in: `b: "x"
+a:
+  d: 1
+  c: 2
+`,
+		want: `a:
+  c: 2
+  d: 1
+b: x
+`,
+	},
+	{
+		name: "ignore_all",
+		in: `b: "x"
+# fumpt:ignore
+a:
+  d: "1"
+  c: 2
+`,
+		want: `# fumpt:ignore
+a:
+  d: "1"
+  c: 2
+b: x
+`,
+	},
+	{
+		name: "ignore_order",
+		in: `b: "x"
+# fumpt:ignore order
+a:
+  d: "y"
+  c: 2
+`,
+		want: `# fumpt:ignore order
+a:
+  d: y
+  c: 2
+b: x
+`,
+	},
+	{
+		name: "ignore_quotes",
+		in: `a:
+  # fumpt:ignore quotes
+  d: "y"
+  c: 'z'
+`,
+		want: `a:
+  c: z
+  # fumpt:ignore quotes
+  d: "y"
+`,
+	},
+	{
+		name: "ignore_single_entry",
+		in: `a:
+  # fumpt:ignore
+  d:
+    f: "y"
+    e: 1
+`,
+		want: `a:
+  # fumpt:ignore
+  d:
+    f: "y"
+    e: 1
+`,
+	},
+	{
+		name: "ignore_sort",
+		in: `- name: b
+  type: group
+  # fumpt:ignore sort
+  fields:
+    - name: d
+    - name: c
+- name: a
+  type: group
+  fields:
+    - name: f
+    - name: e
+`,
+		want: `- name: a
+  type: group
+  fields:
+    - name: e
+    - name: f
+- name: b
+  type: group
+  # fumpt:ignore sort
+  fields:
+    - name: d
+    - name: c
+`,
+	},
+	{
+		name: "ignore_item",
+		in: `processors:
+  - set:
+      value: "x"
+      field: a
+  # fumpt:ignore
+  - set:
+      value: "y"
+      field: b
+`,
+		want: `processors:
+  - set:
+      field: a
+      value: x
+  # fumpt:ignore
+  - set:
+      value: "y"
+      field: b
+`,
+	},
+	{
+		name: "ignore_first_item",
+		in: `processors:
+  # fumpt:ignore
+  - set:
+      value: "y"
+      field: b
+  - set:
+      value: "x"
+      field: a
+`,
+		want: `processors:
+  # fumpt:ignore
+  - set:
+      value: "y"
+      field: b
+  - set:
+      field: a
+      value: x
+`,
+	},
+	{
+		name: "off_on",
+		in: `e: "1"
+# fumpt:off
+d: "2"
+c: "3"
+# fumpt:on
+b: "4"
+a: "5"
+`,
+		want: `e: '1'
+# fumpt:off
+d: "2"
+c: "3"
+# fumpt:on
+b: '4'
+a: '5'
+`,
+	},
+	{
+		name: "off_nested",
+		in: `b: "x"
+a:
+  # fumpt:off
+  d: "1"
+  c: 2
+`,
+		want: `a:
+  # fumpt:off
+  d: "1"
+  c: 2
+b: x
+`,
+	},
+	{
+		name: "off_sequence",
+		in: `- name: b
+  type: group
+  fields:
+    - name: d
+    # fumpt:off
+    - name: "c"
+- name: a
+`,
+		want: `- name: a
+- name: b
+  type: group
+  fields:
+    - name: d
+    # fumpt:off
+    - name: "c"
+`,
+	},
+	{
+		name: "invalid_verb",
+		in: `# fumpt:skip
+a: 1
+`,
+		wantErr: `failed to format document invalid_verb: invalid directive "fumpt:skip" at line 1`,
+	},
+	{
+		name: "invalid_rule",
+		in: `a:
+  # fumpt:ignore ordering
+  b: 1
+  c: 2
+`,
+		wantErr: `failed to format document invalid_rule: invalid directive "fumpt:ignore ordering" at line 2: unknown rule "ordering"`,
+	},
+	{
+		name: "invalid_off",
+		in: `a:
+  # fumpt:off order
+  b: 1
+  c: 2
+`,
+		wantErr: `failed to format document invalid_off: invalid directive "fumpt:off order" at line 2: off takes no rules`,
+	},
+}
+
+func TestDirectives(t *testing.T) {
+	visitors := []Rule{
+		CanonicalQuotes{},
+		CanonicalOrder{"*.field": 0, "*.name": 0, "*.type": 1},
+		SortLists{CanSort: IsECSGroup, Less: LessByName},
+	}
+	for _, test := range directiveTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(test.name, []byte(test.in), visitors)
+			if err != nil {
+				if err.Error() != test.wantErr {
+					t.Errorf("unexpected error: got:%q want:%q", err, test.wantErr)
+				}
+				return
+			}
+			if test.wantErr != "" {
+				t.Fatalf("expected error: %q", test.wantErr)
+			}
+			got = strings.TrimSpace(got)
+			want := strings.TrimSpace(test.want)
+			if got != want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Package format implements formatting of the YAML source in Fleet
+// packages. It canonicalises YAML map field order and quote usage where
+// possible, and in field definition files it orders field definitions
+// lexically by mapping name.
+//
+// Files are formatted according to the conventions for their file class,
+// the package-relative path of the file with data stream, test, field and
+// pipeline names replaced with "*". The conventions for each class are a
+// set of Rules, each providing an ast.Visitor that is applied to the
+// documents in the file. The built-in rules are CanonicalQuotes,
+// CanonicalOrder and SortLists, and the built-in conventions for each
+// package type are held in PackageConventions.
+//
+// JSON files are formatted with canonical indentation, applying only
+// CanonicalOrder rules to order object members and EmbeddedJSON rules to
+// format JSON documents embedded as strings, as in Kibana dashboards.
+//
+// Handlebars templates of agent stream and input configuration are
+// formatted by formatting the YAML fragments between template constructs,
+// leaving the constructs unaltered. CheckVars checks the variables the
+// templates reference against those declared in the package manifests.
+//
+// MigratePipelines converts the JSON ingest pipelines of older packages to
+// YAML following the ingest pipeline conventions.
+package format
+
+import (
+	"bytes"
+	"io"
+)
+
+// Options holds the options for formatting a package.
+type Options struct {
+	// Mode is the action taken with the formatted
+	// result of each file.
+	Mode Mode
+
+	// Output is where the result is written for
+	// all modes other than Rewrite.
+	Output io.Writer
+
+	// Pipeline is whether ingest pipelines are
+	// formatted.
+	Pipeline bool
+
+	// Exclude is a set of gitignore-style patterns
+	// relative to the package root for files to
+	// exclude from formatting in addition to those
+	// listed in the package's .fumptignore files.
+	Exclude []string
+
+	// Pool bounds the number of files formatted
+	// concurrently. If Pool is nil, files are
+	// formatted sequentially.
+	Pool Pool
+
+	// Include, if not nil, restricts formatting to
+	// files with package-relative paths for which
+	// it returns true.
+	Include func(rel string) bool
+}
+
+// FormatFile returns the formatted YAML source src of the file at the
+// package-relative path relPath using the integration package conventions.
+// If the file's class has no conventions, src is returned unaltered. As for
+// FormatPackageFile without the Pipeline option, ingest pipelines are not
+// formatted.
+func FormatFile(relPath string, src []byte) ([]byte, error) {
+	return FormatPackageFile("", relPath, src, Options{})
+}
+
+// FormatPackage formats the files in the package rooted at root according
+// to opts using the conventions for the package's type merged with any
+// project configuration. Files that cannot be formatted do not prevent
+// formatting of the remaining files; their errors are returned together
+// as a FileErrors, unless opts.Mode is Report. FormatPackage returns a
+// summary of the files formatted.
+func FormatPackage(root string, opts Options) (Summary, error) {
+	rules, err := packageRules(root, opts.Pipeline)
+	if err != nil {
+		return Summary{}, err
+	}
+	ignore, err := packageIgnore(root, opts.Exclude)
+	if err != nil {
+		return Summary{}, err
+	}
+	return walk(root, opts.Output, rules, opts.Mode, opts.Pool, ignore, opts.Include)
+}
+
+// FormatPackageFile returns the formatted YAML source src of the file at the
+// package-relative path rel in the package rooted at root, using the package's
+// conventions and configuration. If root is empty, the integration package
+// conventions are used. If the file is excluded from formatting or its class
+// has no conventions, src is returned unaltered. Only the Pipeline and Exclude
+// options are used.
+func FormatPackageFile(root, rel string, src []byte, opts Options) ([]byte, error) {
+	var (
+		rules    map[string][]Rule
+		ignore   ignorer
+		manifest map[string]interface{}
+		err      error
+	)
+	if root == "" {
+		rules, err = config{}.merge(Conventions)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Pipeline {
+			for _, c := range pipelineClasses {
+				delete(rules, c)
+			}
+		}
+		ignore, err = parseExcludes(opts.Exclude)
+	} else {
+		rules, err = packageRules(root, opts.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		ignore, err = packageIgnore(root, opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err = readManifest(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ignore.excludesRoot() || ignore.excludes(rel) {
+		return src, nil
+	}
+	var buf bytes.Buffer
+	err = formatStream(&buf, bytes.NewReader(src), rel, rules, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckPattern returns an error if pattern is not a valid gitignore-style
+// pattern for Options.Exclude.
+func CheckPattern(pattern string) error {
+	_, err := parseExcludes([]string{pattern})
+	return err
+}
+
+// pipelineClasses are the file classes of ingest pipelines.
+var pipelineClasses = []string{
+	"data_stream/*/elasticsearch/ingest_pipeline/*.yml",
+	"data_stream/*/elasticsearch/ingest_pipeline/*.json",
+}
+
+// packageRules returns the conventions for the package rooted at root.
+// Ingest pipeline conventions are only included if pipeline is true.
+func packageRules(root string, pipeline bool) (map[string][]Rule, error) {
+	typ, err := packageType(root)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := loadConventions(root, PackageConventions[typ])
+	if err != nil {
+		return nil, err
+	}
+	if !pipeline {
+		for _, c := range pipelineClasses {
+			delete(rules, c)
+		}
+	}
+	return rules, nil
+}
+
+// packageIgnore returns the ignorer for the package rooted at root with
+// the additional package-relative patterns in exclude.
+func packageIgnore(root string, exclude []string) (ignorer, error) {
+	ex, err := parseExcludes(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return loadIgnore(root, ex)
+}
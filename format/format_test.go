@@ -0,0 +1,162 @@
+package format
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var formatFileTests = []struct {
+	name string
+	rel  string
+	src  string
+	want string
+}{
+	{
+		name: "manifest",
+		rel:  "manifest.yml",
+		src:  "version: '1.0.0'\nname: \"pkg\"\n",
+		want: "name: pkg\nversion: 1.0.0\n",
+	},
+	{
+		name: "no_class",
+		rel:  "unknown.yml",
+		src:  "version: '1.0.0'\nname: \"pkg\"\n",
+		want: "version: '1.0.0'\nname: \"pkg\"\n",
+	},
+	{
+		name: "pipeline",
+		rel:  "data_stream/log/elasticsearch/ingest_pipeline/default.yml",
+		src:  "processors: []\ndescription: 'Pipeline'\n",
+		want: "processors: []\ndescription: 'Pipeline'\n",
+	},
+}
+
+func TestFormatFile(t *testing.T) {
+	for _, test := range formatFileTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FormatFile(test.rel, []byte(test.src))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(string(got), test.want))
+			}
+		})
+	}
+}
+
+func TestFormatFileInternalError(t *testing.T) {
+	// The YAML parser panics on an empty
+	// literal block scalar at end of input.
+	_, err := FormatFile("_dev/build/build.yml", []byte("program: |\n"))
+	if err == nil || !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("unexpected error: got:%v want:internal error", err)
+	}
+}
+
+func TestFormatPackage(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []struct{ path, data string }{
+		{path: "manifest.yml", data: "name: pkg\ntype: integration\n"},
+		{path: "changelog.yml", data: "- version: '1.0.0'\n"},
+		{path: "data_stream/log/manifest.yml", data: "title: 'Log'\n"},
+		{path: "data_stream/log/elasticsearch/ingest_pipeline/default.yml", data: "description: 'Pipeline'\n"},
+		{path: "_dev/deploy/docker/docker-compose.yml", data: "version: '2.3'\n"},
+	} {
+		write(t, filepath.Join(dir, filepath.FromSlash(f.path)), f.data)
+	}
+
+	for _, test := range []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{
+				"changelog.yml",
+				"data_stream/log/manifest.yml",
+			},
+		},
+		{
+			name: "pipeline",
+			opts: Options{Pipeline: true},
+			want: []string{
+				"changelog.yml",
+				"data_stream/log/elasticsearch/ingest_pipeline/default.yml",
+				"data_stream/log/manifest.yml",
+			},
+		},
+		{
+			name: "exclude",
+			opts: Options{Exclude: []string{"data_stream/"}},
+			want: []string{
+				"changelog.yml",
+			},
+		},
+		{
+			name: "include",
+			opts: Options{Include: func(rel string) bool { return rel == "changelog.yml" }},
+			want: []string{
+				"changelog.yml",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := test.opts
+			opts.Mode = List
+			opts.Output = &buf
+			sum, err := FormatPackage(dir, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := make([]string, len(test.want))
+			for i, p := range test.want {
+				want[i] = DisplayPath(filepath.Join(dir, filepath.FromSlash(p)))
+			}
+			got := strings.Fields(buf.String())
+			if !cmp.Equal(got, want) {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+			}
+			if sum.Changed != len(want) {
+				t.Errorf("unexpected number of changed files: got:%d want:%d", sum.Changed, len(want))
+			}
+		})
+	}
+}
+
+func TestFormatPackageFile(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "manifest.yml"), "type: integration\nname: pkg\n")
+	write(t, filepath.Join(dir, ignoreName), "data_stream/*/manifest.yml\n")
+	src := []byte("title: 'Log'\n")
+
+	for _, test := range []struct {
+		name string
+		root string
+		rel  string
+		opts Options
+		want string
+	}{
+		{name: "package", root: dir, rel: "changelog.yml", want: "title: Log\n"},
+		{name: "ignored", root: dir, rel: "data_stream/log/manifest.yml", want: "title: 'Log'\n"},
+		{name: "excluded", root: dir, rel: "changelog.yml", opts: Options{Exclude: []string{"changelog.yml"}}, want: "title: 'Log'\n"},
+		{name: "no_package", rel: "data_stream/log/manifest.yml", want: "title: Log\n"},
+		{name: "no_package_pipeline", rel: "data_stream/log/elasticsearch/ingest_pipeline/default.yml", want: "title: 'Log'\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := FormatPackageFile(test.root, test.rel, src, test.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(string(got), test.want))
+			}
+		})
+	}
+}
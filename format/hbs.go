@@ -0,0 +1,326 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+)
+
+// templateSuffix is the file name suffix of Handlebars templates of YAML
+// source.
+const templateSuffix = ".yml.hbs"
+
+// isTemplate returns whether the file at path is a Handlebars template of
+// YAML source.
+func isTemplate(path string) bool {
+	return strings.HasSuffix(path, templateSuffix)
+}
+
+// templateExpr matches Handlebars expressions. Comments are matched first
+// since they may contain "}}".
+var templateExpr = regexp.MustCompile(`(?s)\{\{!--.*?--\}\}|\{\{\{.*?\}\}\}|\{\{.*?\}\}`)
+
+// placeholderPrefix is the prefix of the plain scalar text substituted for
+// inline Handlebars expressions while YAML fragments are formatted.
+const placeholderPrefix = "__fumpt_hbs_"
+
+var placeholder = regexp.MustCompile(placeholderPrefix + `([0-9]+)__`)
+
+// applyTemplateRules implements applyRules for Handlebars templates of YAML
+// source.
+//
+// Lines holding only Handlebars expressions, such as block helpers and
+// variables expanding to YAML, are retained unaltered, and the YAML
+// fragments between them are formatted separately. Inline expressions in a
+// fragment are replaced with placeholders while it is formatted, and quoted
+// strings holding them retain their quoting. Entries ending a fragment with
+// collection or empty values remain last so that the template following
+// the fragment may continue them.
+// Fragments that are not valid YAML on their own are retained unaltered.
+func applyTemplateRules(path string, ctx Context, src []byte, rules []Rule, trace bool) (data string, changedBy []string, err error) {
+	text := string(src)
+	if strings.Contains(text, placeholderPrefix) {
+		return "", nil, fmt.Errorf("failed to format document %s: template contains reserved text %q", path, placeholderPrefix)
+	}
+	lines := splitLines(text)
+	start := make([]int, len(lines))
+	for i, off := 0, 0; i < len(lines); i++ {
+		start[i] = off
+		off += len(lines[i])
+	}
+	lineOf := func(off int) int {
+		return sort.SearchInts(start, off+1) - 1
+	}
+
+	// Find the lines that are only template constructs
+	// and the inline expressions on other lines.
+	template := make([]bool, len(lines))
+	inline := make([][][]int, len(lines))
+	for _, e := range templateExpr.FindAllStringIndex(text, -1) {
+		first, last := lineOf(e[0]), lineOf(e[1]-1)
+		if first != last {
+			for i := first; i <= last; i++ {
+				template[i] = true
+			}
+			continue
+		}
+		inline[first] = append(inline[first], []int{e[0] - start[first], e[1] - start[first]})
+	}
+	var exprs []string
+	for i, l := range lines {
+		if template[i] || len(inline[i]) == 0 {
+			continue
+		}
+		var (
+			rest strings.Builder
+			repl strings.Builder
+			prev int
+		)
+		for _, e := range inline[i] {
+			rest.WriteString(l[prev:e[0]])
+			repl.WriteString(l[prev:e[0]])
+			fmt.Fprintf(&repl, "%s%d__", placeholderPrefix, len(exprs))
+			exprs = append(exprs, l[e[0]:e[1]])
+			prev = e[1]
+		}
+		rest.WriteString(l[prev:])
+		repl.WriteString(l[prev:])
+		if strings.TrimSpace(rest.String()) == "" {
+			template[i] = true
+			exprs = exprs[:len(exprs)-len(inline[i])]
+			continue
+		}
+		lines[i] = repl.String()
+	}
+
+	var (
+		buf     strings.Builder
+		changed = make(map[string]bool)
+	)
+	for i := 0; i < len(lines); {
+		if template[i] {
+			buf.WriteString(lines[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(lines) && !template[j] {
+			j++
+		}
+		if k, ok := blockScalarEnd(lines, i, j); ok {
+			// The block scalar ending the fragment
+			// is completed by the template lines
+			// following it, so the fragment cannot
+			// be parsed alone.
+			buf.WriteString(strings.Join(lines[i:k], ""))
+			i = k
+			continue
+		}
+		frag, names, err := formatFragment(path, ctx, lines[i:j], j < len(lines), rules, trace)
+		if err != nil {
+			return "", nil, err
+		}
+		buf.WriteString(frag)
+		for _, n := range names {
+			changed[n] = true
+		}
+		i = j
+	}
+	data = placeholder.ReplaceAllStringFunc(buf.String(), func(s string) string {
+		i, _ := strconv.Atoi(placeholder.FindStringSubmatch(s)[1])
+		return exprs[i]
+	})
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	for _, r := range rules {
+		name := ruleName(r)
+		if changed[name] {
+			changedBy = append(changedBy, name)
+			delete(changed, name)
+		}
+	}
+	return data, changedBy, nil
+}
+
+// blockHeader matches a line ending in a block scalar header.
+var blockHeader = regexp.MustCompile(`(?:^\s*|[:-]\s+)[|>][1-9+-]{0,2}(?:\s+#.*)?\s*$`)
+
+// blockScalarEnd returns the end of the lines continuing the block scalar
+// whose header ends the fragment held in lines[i:j], and whether the
+// fragment ends in a block scalar header. The continuing lines are the
+// blank lines and those more indented than the header.
+func blockScalarEnd(lines []string, i, j int) (end int, ok bool) {
+	last := j - 1
+	for last >= i && strings.TrimSpace(lines[last]) == "" {
+		last--
+	}
+	if last < i || !blockHeader.MatchString(strings.TrimRight(lines[last], "\r\n")) {
+		return j, false
+	}
+	indent := len(lines[last]) - len(strings.TrimLeft(lines[last], " "))
+	end = j
+	for end < len(lines) {
+		l := lines[end]
+		if strings.TrimSpace(l) != "" && len(l)-len(strings.TrimLeft(l, " ")) <= indent {
+			break
+		}
+		end++
+	}
+	return end, true
+}
+
+// formatFragment returns the formatted YAML fragment held in lines, and
+// the names of the rules that altered it if trace is true. The fragment
+// is formatted at its least indentation and leading and trailing blank
+// lines are retained. If open is true, the fragment is followed by template
+// constructs that may continue it. If the fragment is not valid YAML or
+// holds only comments, it is returned unaltered.
+func formatFragment(path string, ctx Context, lines []string, open bool, rules []Rule, trace bool) (string, []string, error) {
+	i, j := 0, len(lines)
+	for i < j && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	for j > i && strings.TrimSpace(lines[j-1]) == "" {
+		j--
+	}
+	body := lines[i:j]
+	indent := -1
+	for _, l := range body {
+		t := strings.TrimLeft(l, " ")
+		if strings.TrimSpace(t) == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if n := len(l) - len(t); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent < 0 {
+		return strings.Join(lines, ""), nil, nil
+	}
+
+	var src strings.Builder
+	for _, l := range body {
+		if len(l)-len(strings.TrimLeft(l, " ")) < indent {
+			// Blank lines and comments may be
+			// less indented.
+			l = strings.TrimLeft(l, " ")
+		} else {
+			l = l[indent:]
+		}
+		src.WriteString(l)
+	}
+	protect := protectTemplated
+	if open {
+		protect = protectFragment
+	}
+	data, changedBy, err := applyYAMLRules(path, ctx, []byte(src.String()), rules, trace, protect)
+	if err != nil {
+		var perr *parseError
+		if errors.As(err, &perr) {
+			return strings.Join(lines, ""), nil, nil
+		}
+		return "", nil, err
+	}
+
+	out := splitLines(data)
+	if strings.HasSuffix(strings.TrimSpace(body[len(body)-1]), ":") {
+		// The fragment ends with an empty value which is
+		// completed by the template following it, but
+		// is rendered as an explicit null.
+		last := len(out) - 1
+		out[last] = strings.TrimSuffix(strings.TrimSuffix(out[last], "\n"), " null") + "\n"
+	}
+
+	var buf strings.Builder
+	for _, l := range lines[:i] {
+		buf.WriteString(l)
+	}
+	pad := strings.Repeat(" ", indent)
+	for _, l := range out {
+		if strings.TrimSpace(l) != "" {
+			buf.WriteString(pad)
+		}
+		buf.WriteString(l)
+	}
+	for _, l := range lines[j:] {
+		buf.WriteString(l)
+	}
+	return buf.String(), changedBy, nil
+}
+
+// protectTemplated disables quote changes in the YAML fragment document doc
+// for quoted strings holding expression placeholders since the values of
+// the expressions are not known.
+func protectTemplated(doc ast.Node, d *directives) {
+	ast.Walk(templatedStrings{d}, doc)
+}
+
+// protectFragment protects the YAML fragment document doc as for
+// protectTemplated, and additionally keeps the entries ending the fragment
+// last where their values may be continued by the template that follows.
+func protectFragment(doc ast.Node, d *directives) {
+	protectTemplated(doc, d)
+
+	n := doc
+	if doc, ok := doc.(*ast.DocumentNode); ok {
+		n = doc.Body
+	}
+	for n != nil {
+		switch m := n.(type) {
+		case *ast.MappingNode:
+			if len(m.Values) == 0 {
+				return
+			}
+			last := m.Values[len(m.Values)-1]
+			if !isOpen(last.Value) {
+				return
+			}
+			d.keepLast[m] = last
+			n = last.Value
+		case *ast.MappingValueNode:
+			n = m.Value
+		case *ast.SequenceNode:
+			d.pinned[m] = true
+			if len(m.Values) == 0 {
+				return
+			}
+			n = m.Values[len(m.Values)-1]
+		default:
+			return
+		}
+	}
+}
+
+// isOpen returns whether n is a value that may be continued by following
+// lines of a template.
+func isOpen(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.MappingNode, *ast.MappingValueNode, *ast.SequenceNode, *ast.NullNode:
+		return true
+	default:
+		return false
+	}
+}
+
+// templatedStrings is an ast.Visitor that disables quote changes for
+// quoted strings holding expression placeholders.
+type templatedStrings struct {
+	d *directives
+}
+
+func (v templatedStrings) Visit(n ast.Node) ast.Visitor {
+	if n, ok := n.(*ast.StringNode); ok && placeholder.MatchString(n.Token.Value) {
+		switch n.Token.Type {
+		case token.SingleQuoteType, token.DoubleQuoteType:
+			v.d.disable(n, "quotes")
+		}
+	}
+	return v
+}
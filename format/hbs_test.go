@@ -0,0 +1,202 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var templateTests = []struct {
+	name    string
+	in      string
+	want    string
+	wantErr string
+}{
+	{
+		name: "quotes",
+		in: `host: "{{host}}:{{port}}"
+path: '{{path}}'
+mode: "read"
+`,
+		want: `host: "{{host}}:{{port}}"
+mode: read
+path: '{{path}}'
+`,
+	},
+	{
+		name: "unquoted_expression",
+		in: `tags:
+  - {{tag}}
+  - "forwarded"
+`,
+		want: `tags:
+  - {{tag}}
+  - forwarded
+`,
+	},
+	{
+		name: "block_helpers",
+		in: `paths:
+{{#each paths as |path|}}
+  - {{path}}
+{{/each}}
+{{#if processors}}
+processors:
+{{processors}}
+{{/if}}
+`,
+		want: `paths:
+{{#each paths as |path|}}
+  - {{path}}
+{{/each}}
+{{#if processors}}
+processors:
+{{processors}}
+{{/if}}
+`,
+	},
+	{
+		name: "fragment_order",
+		in: `c: 1
+b: 2
+d: 4
+{{#if a}}
+a: 3
+{{/if}}
+`,
+		want: `b: 2
+c: 1
+d: 4
+{{#if a}}
+a: 3
+{{/if}}
+`,
+	},
+	{
+		name: "last_entry_kept",
+		in: `z: 1
+fields:
+  y: 2
+  w: 3
+  x:
+{{#each x}}
+    - {{this}}
+{{/each}}
+`,
+		want: `z: 1
+fields:
+  w: 3
+  y: 2
+  x:
+{{#each x}}
+    - {{this}}
+{{/each}}
+`,
+	},
+	{
+		name: "indented_fragment",
+		in: `options:
+{{#if tls}}
+  tls:
+    verification_mode: "full"
+    enabled: true
+{{/if}}
+`,
+		want: `options:
+{{#if tls}}
+  tls:
+    enabled: true
+    verification_mode: full
+{{/if}}
+`,
+	},
+	{
+		name: "multiline_comment",
+		in: `{{!--
+  b: 'x'
+  a: 'y'
+--}}
+b: 'x'
+a: 'y'
+`,
+		want: `{{!--
+  b: 'x'
+  a: 'y'
+--}}
+a: y
+b: x
+`,
+	},
+	{
+		name: "invalid_fragment",
+		in: `{{#if a}}
+b: 'x'
+{c: 1
+{{/if}}
+`,
+		want: `{{#if a}}
+b: 'x'
+{c: 1
+{{/if}}
+`,
+	},
+	{
+		name: "block_scalar_template",
+		in: `interval: "{{interval}}"
+program: |
+  {{program}}
+  // Trailer.
+
+mode: "read"
+redact:
+  fields:
+    - "a"
+`,
+		want: `interval: "{{interval}}"
+program: |
+  {{program}}
+  // Trailer.
+
+mode: read
+redact:
+  fields:
+    - a
+`,
+	},
+	{
+		name: "block_scalar_end",
+		in: `mode: "read"
+program: >-
+`,
+		want: `mode: "read"
+program: >-
+`,
+	},
+	{
+		name: "reserved_text",
+		in: `a: __fumpt_hbs_0__
+`,
+		wantErr: `failed to format document reserved_text.yml.hbs: template contains reserved text "__fumpt_hbs_"`,
+	},
+}
+
+func TestTemplates(t *testing.T) {
+	rules := []Rule{CanonicalQuotes{}, CanonicalOrder{}}
+	for _, test := range templateTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(test.name+".yml.hbs", []byte(test.in), rules)
+			if err != nil {
+				if err.Error() != test.wantErr {
+					t.Errorf("unexpected error: got:%q want:%q", err, test.wantErr)
+				}
+				return
+			}
+			if test.wantErr != "" {
+				t.Fatalf("expected error: %q", test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreName is the name of the file listing paths to exclude from
+// formatting.
+const ignoreName = ".fumptignore"
+
+// ignorer reports whether package-relative paths are excluded from
+// formatting. Patterns use gitignore syntax and later patterns take
+// precedence over earlier patterns. A nil ignorer excludes nothing.
+type ignorer []ignorePattern
+
+// ignorePattern is a single gitignore-style pattern.
+type ignorePattern struct {
+	// prefix is the slash-separated path of the package
+	// root relative to the directory the pattern is
+	// relative to, with a trailing slash, or empty if the
+	// pattern is relative to the package root.
+	prefix string
+
+	// segments is the slash-separated pattern split into
+	// path elements. A "**" element matches zero or more
+	// path elements.
+	segments []string
+
+	// negate is whether the pattern re-includes paths
+	// excluded by an earlier pattern.
+	negate bool
+
+	// dirOnly is whether the pattern only matches
+	// directories.
+	dirOnly bool
+}
+
+// ignored returns whether the file or directory at the package-relative
+// path rel is excluded from formatting.
+func (ig ignorer) ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	var ignored bool
+	for _, p := range ig {
+		if p.match(rel, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// excludes returns whether the file at the package-relative path rel, or
+// any directory containing it, is excluded from formatting.
+func (ig ignorer) excludes(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for i, c := range rel {
+		if c == '/' && ig.ignored(rel[:i], true) {
+			return true
+		}
+	}
+	return ig.ignored(rel, false)
+}
+
+// excludesRoot returns whether the package root, or any directory
+// containing it, is excluded by the patterns of ignore files above the
+// package.
+func (ig ignorer) excludesRoot() bool {
+	var depth int
+	for _, p := range ig {
+		if n := len(p.rootPath()); n > depth {
+			depth = n
+		}
+	}
+	// Check the outermost directories first; a file
+	// cannot be re-included if its directory is excluded.
+	for up := depth - 1; up >= 0; up-- {
+		var ignored bool
+		for _, p := range ig {
+			if p.matchAbove(up) {
+				ignored = !p.negate
+			}
+		}
+		if ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// rootPath returns the path elements of the package root relative to the
+// directory the pattern is relative to.
+func (p ignorePattern) rootPath() []string {
+	if p.prefix == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(p.prefix, "/"), "/")
+}
+
+// matchAbove returns whether the pattern matches the directory up levels
+// above the package root, or the package root itself if up is zero.
+func (p ignorePattern) matchAbove(up int) bool {
+	elems := p.rootPath()
+	if up >= len(elems) {
+		// The directory is not below the
+		// directory holding the pattern.
+		return false
+	}
+	return matchSegments(p.segments, elems[:len(elems)-up])
+}
+
+// match returns whether the pattern matches the package-relative
+// slash-separated path rel.
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(p.prefix+rel, "/"))
+}
+
+// matchSegments returns whether the path elements in name match the
+// pattern elements in pat.
+func matchSegments(pat, name []string) bool {
+	for len(pat) != 0 {
+		if pat[0] == "**" {
+			pat = pat[1:]
+			if len(pat) == 0 {
+				// A trailing "**" matches everything
+				// within, but not the directory itself.
+				return len(name) != 0
+			}
+			for i := range name {
+				if matchSegments(pat, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pat[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// parseIgnorePattern returns the pattern for a gitignore-style pattern
+// line relative to the directory where the package root has the path
+// prefix. ok is false if the line holds no pattern.
+func parseIgnorePattern(prefix, line string) (p ignorePattern, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+	p.prefix = prefix
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, `\`) {
+		// Escaped leading '!' or '#'.
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if !strings.Contains(line, "/") {
+		// Patterns without a separator match at any depth.
+		line = "**/" + line
+	}
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return p, false, errors.New("empty pattern")
+	}
+	p.segments = strings.Split(line, "/")
+	for _, s := range p.segments {
+		_, err = path.Match(s, "")
+		if err != nil {
+			return p, false, err
+		}
+	}
+	return p, true, nil
+}
+
+// parseExcludes returns an ignorer for the package-relative gitignore-style
+// patterns in patterns.
+func parseExcludes(patterns []string) (ignorer, error) {
+	var ig ignorer
+	for _, l := range patterns {
+		p, ok, err := parseIgnorePattern("", l)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", l, err)
+		}
+		if ok {
+			ig = append(ig, p)
+		}
+	}
+	return ig, nil
+}
+
+// loadIgnore returns the ignorer for the package rooted at root. Patterns
+// are read from the ignore files in root and its parents up to the root
+// of the repository containing the package, each relative to the directory
+// holding the file. Patterns in files nearer to the package root take
+// precedence, and the patterns in exclude take precedence over all files.
+func loadIgnore(root string, exclude ignorer) (ignorer, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for d := abs; ; {
+		dirs = append(dirs, d)
+		_, err := os.Stat(filepath.Join(d, ".git"))
+		if err == nil {
+			// We are at the repository root.
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	var ig ignorer
+	for i := len(dirs) - 1; i >= 0; i-- {
+		p := filepath.Join(dirs[i], ignoreName)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		prefix, err := filepath.Rel(dirs[i], abs)
+		if err != nil {
+			return nil, err
+		}
+		if prefix == "." {
+			prefix = ""
+		} else {
+			prefix = filepath.ToSlash(prefix) + "/"
+		}
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for line := 1; sc.Scan(); line++ {
+			pat, ok, err := parseIgnorePattern(prefix, sc.Text())
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern in %s:%d: %w", p, line, err)
+			}
+			if ok {
+				ig = append(ig, pat)
+			}
+		}
+		err = sc.Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(ig, exclude...), nil
+}
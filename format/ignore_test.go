@@ -0,0 +1,192 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var ignoreTests = []struct {
+	name     string
+	patterns []string
+	prefix   string
+	rel      string
+	isDir    bool
+	want     bool
+}{
+	{name: "none", rel: "manifest.yml", want: false},
+	{name: "base", patterns: []string{"manifest.yml"}, rel: "manifest.yml", want: true},
+	{name: "base_deep", patterns: []string{"*.yml"}, rel: "data_stream/log/manifest.yml", want: true},
+	{name: "anchored", patterns: []string{"/manifest.yml"}, rel: "data_stream/log/manifest.yml", want: false},
+	{name: "anchored_match", patterns: []string{"/manifest.yml"}, rel: "manifest.yml", want: true},
+	{name: "path", patterns: []string{"_dev/deploy"}, rel: "_dev/deploy", isDir: true, want: true},
+	{name: "path_no_match", patterns: []string{"_dev/deploy"}, rel: "data_stream/log/_dev/deploy", isDir: true, want: false},
+	{name: "path_glob", patterns: []string{"data_stream/*/_dev/deploy"}, rel: "data_stream/log/_dev/deploy", isDir: true, want: true},
+	{name: "double_star_leading", patterns: []string{"**/_dev/deploy"}, rel: "data_stream/log/_dev/deploy", isDir: true, want: true},
+	{name: "double_star_middle", patterns: []string{"data_stream/**/deploy"}, rel: "data_stream/log/_dev/deploy", isDir: true, want: true},
+	{name: "double_star_trailing", patterns: []string{"_dev/**"}, rel: "_dev/deploy/docker/docker-compose.yml", want: true},
+	{name: "double_star_trailing_dir", patterns: []string{"_dev/**"}, rel: "_dev", isDir: true, want: false},
+	{name: "dir_only", patterns: []string{"deploy/"}, rel: "_dev/deploy", isDir: true, want: true},
+	{name: "dir_only_file", patterns: []string{"deploy/"}, rel: "deploy", want: false},
+	{name: "negate", patterns: []string{"*.yml", "!manifest.yml"}, rel: "manifest.yml", want: false},
+	{name: "negate_order", patterns: []string{"!manifest.yml", "*.yml"}, rel: "manifest.yml", want: true},
+	{name: "comment", patterns: []string{"# manifest.yml"}, rel: "# manifest.yml", want: false},
+	{name: "escaped", patterns: []string{`\#manifest.yml`}, rel: "#manifest.yml", want: true},
+	{name: "prefix", patterns: []string{"packages/pkg/_dev"}, prefix: "packages/pkg/", rel: "_dev", isDir: true, want: true},
+	{name: "prefix_no_match", patterns: []string{"packages/other/_dev"}, prefix: "packages/pkg/", rel: "_dev", isDir: true, want: false},
+}
+
+func TestIgnorer(t *testing.T) {
+	for _, test := range ignoreTests {
+		t.Run(test.name, func(t *testing.T) {
+			var ig ignorer
+			for _, l := range test.patterns {
+				p, ok, err := parseIgnorePattern(test.prefix, l)
+				if err != nil {
+					t.Fatalf("unexpected error parsing %q: %v", l, err)
+				}
+				if ok {
+					ig = append(ig, p)
+				}
+			}
+			got := ig.ignored(test.rel, test.isDir)
+			if got != test.want {
+				t.Errorf("unexpected result for %s: got:%t want:%t", test.rel, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseExcludes(t *testing.T) {
+	_, err := parseExcludes([]string{"_dev/[deploy"})
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	ig, err := parseExcludes([]string{"_dev/deploy", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ig) != 1 {
+		t.Errorf("unexpected number of patterns: got:%d want:1", len(ig))
+	}
+	if !ig.excludes(filepath.Join("_dev", "deploy", "docker", "docker-compose.yml")) {
+		t.Error("expected file in excluded directory to be excluded")
+	}
+}
+
+func TestWalkIgnore(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, ".git"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to make repository root: %v", err)
+	}
+	pkg := filepath.Join(dir, "packages", "pkg")
+	for _, f := range []struct{ path, data string }{
+		{path: filepath.Join(dir, ignoreName), data: "packages/*/data_stream/b/\n"},
+		{path: filepath.Join(pkg, ignoreName), data: "# Vendored fixtures.\n_dev/deploy\n"},
+		{path: filepath.Join(pkg, "_dev", "deploy", "docker", "docker-compose.yml"), data: "b: 'x'\na: 1\n"},
+		{path: filepath.Join(pkg, "data_stream", "a", "manifest.yml"), data: "title: 'a'\n"},
+		{path: filepath.Join(pkg, "data_stream", "b", "manifest.yml"), data: "title: 'b'\n"},
+		{path: filepath.Join(pkg, "data_stream", "c", "manifest.yml"), data: "title: 'c'\n"},
+	} {
+		write(t, f.path, f.data)
+	}
+
+	exclude, err := parseExcludes([]string{"data_stream/c"})
+	if err != nil {
+		t.Fatalf("unexpected error parsing excludes: %v", err)
+	}
+	ignore, err := loadIgnore(pkg, exclude)
+	if err != nil {
+		t.Fatalf("unexpected error loading ignore files: %v", err)
+	}
+	visitors := []Rule{CanonicalQuotes{}}
+	rules := map[string][]Rule{
+		"_dev/deploy/docker/docker-compose.yml": visitors,
+		"data_stream/*/manifest.yml":            visitors,
+	}
+	var buf bytes.Buffer
+	_, err = walk(pkg, &buf, rules, List, nil, ignore, nil)
+	if err != nil {
+		t.Fatalf("unexpected error during walk: %v", err)
+	}
+	got := strings.Fields(buf.String())
+	want := []string{DisplayPath(filepath.Join(pkg, "data_stream", "a", "manifest.yml"))}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestIgnorerRoot(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		patterns []string
+		prefix   string
+		want     bool
+	}{
+		{name: "none", prefix: "packages/vend/", want: false},
+		{name: "package_relative", patterns: []string{"vend"}, prefix: "", want: false},
+		{name: "root_dir", patterns: []string{"packages/vend/"}, prefix: "packages/vend/", want: true},
+		{name: "root_name", patterns: []string{"vend"}, prefix: "packages/vend/", want: true},
+		{name: "root_glob", patterns: []string{"packages/v*"}, prefix: "packages/vend/", want: true},
+		{name: "ancestor", patterns: []string{"packages/"}, prefix: "packages/vend/", want: true},
+		{name: "ancestor_negated_root", patterns: []string{"packages/", "!packages/vend"}, prefix: "packages/vend/", want: true},
+		{name: "negated", patterns: []string{"vend", "!packages/vend"}, prefix: "packages/vend/", want: false},
+		{name: "other", patterns: []string{"packages/other/"}, prefix: "packages/vend/", want: false},
+		{name: "contents", patterns: []string{"packages/vend/**"}, prefix: "packages/vend/", want: false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var ig ignorer
+			for _, l := range test.patterns {
+				p, ok, err := parseIgnorePattern(test.prefix, l)
+				if err != nil {
+					t.Fatalf("unexpected error parsing %q: %v", l, err)
+				}
+				if ok {
+					ig = append(ig, p)
+				}
+			}
+			got := ig.excludesRoot()
+			if got != test.want {
+				t.Errorf("unexpected result: got:%t want:%t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIgnorePackage(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, ".git"), 0o755)
+	if err != nil {
+		t.Fatalf("failed to make repository root: %v", err)
+	}
+	for _, f := range []struct{ path, data string }{
+		{path: filepath.Join(dir, ignoreName), data: "packages/vend/\n"},
+		{path: filepath.Join(dir, "packages", "vend", "manifest.yml"), data: "type: integration\ntitle: 'vend'\nname: vend\n"},
+		{path: filepath.Join(dir, "packages", "pkg", "manifest.yml"), data: "type: integration\ntitle: 'pkg'\nname: pkg\n"},
+	} {
+		write(t, f.path, f.data)
+	}
+
+	got, err := FindPackages(filepath.Join(dir, "packages"))
+	if err != nil {
+		t.Fatalf("unexpected error finding packages: %v", err)
+	}
+	want := []string{filepath.Join(dir, "packages", "pkg")}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected packages:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+
+	var buf bytes.Buffer
+	sum, err := FormatPackage(filepath.Join(dir, "packages", "vend"), Options{Mode: List, Output: &buf})
+	if err != nil {
+		t.Fatalf("unexpected error formatting excluded package: %v", err)
+	}
+	if buf.Len() != 0 || sum != (Summary{}) {
+		t.Errorf("unexpected result formatting excluded package: %+v\n%s", sum, &buf)
+	}
+}
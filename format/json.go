@@ -0,0 +1,263 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isJSON returns whether the file at path is JSON source.
+func isJSON(path string) bool {
+	return strings.HasSuffix(path, ".json")
+}
+
+// jsonIndent is the indentation of each level of formatted JSON.
+const jsonIndent = "    "
+
+// jsonObject is a decoded JSON object retaining the order of its members.
+type jsonObject []jsonMember
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// applyJSONRules implements applyRules for JSON source. The source is
+// written with canonical indentation and a single trailing newline. Only
+// rules implementing jsonRule are applied.
+func applyJSONRules(path string, ctx Context, src []byte, rules []Rule, trace bool) (data string, changedBy []string, err error) {
+	var orig interface{}
+	err = json.Unmarshal(src, &orig)
+	if err != nil {
+		return "", nil, newJSONParseError(path, src, err)
+	}
+	v, err := decodeJSON(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode document %s: %w", path, err)
+	}
+	var prev string
+	if trace {
+		prev = encodeJSON(v)
+	}
+	ctx.embedded = make(map[string]bool)
+	for _, r := range rules {
+		jr, ok := r.(jsonRule)
+		if !ok {
+			continue
+		}
+		jr.formatJSON(&ctx, v)
+		if trace {
+			cur := encodeJSON(v)
+			if cur != prev {
+				changedBy = append(changedBy, ruleName(r))
+			}
+			prev = cur
+		}
+	}
+	data = encodeJSON(v)
+	err = checkJSONEquivalent(orig, data, ctx.embedded)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to format document %s: %w", path, err)
+	}
+	return data, changedBy, nil
+}
+
+// decodeJSON returns the JSON value in src, with objects decoded as
+// jsonObject and numbers as json.Number. The source must be valid JSON.
+func decodeJSON(src []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+	return decodeJSONValue(dec)
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{key: tok.(string), value: v})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	default:
+		return tok, nil
+	}
+}
+
+// newJSONParseError returns a parseError for the encoding/json decode
+// error err in the file at path with the source src.
+func newJSONParseError(path string, src []byte, err error) *parseError {
+	e := &parseError{path: path, msg: err.Error()}
+	var serr *json.SyntaxError
+	if errors.As(err, &serr) && serr.Offset > 0 {
+		// The offset is that following the
+		// offending byte.
+		i := int(serr.Offset) - 1
+		if i > len(src) {
+			i = len(src)
+		}
+		e.line = bytes.Count(src[:i], []byte("\n")) + 1
+		e.column = i - bytes.LastIndexByte(src[:i], '\n')
+	}
+	return e
+}
+
+// formatJSON orders the members of the objects in the JSON document v as
+// for YAML mappings with the same paths.
+func (v CanonicalOrder) formatJSON(_ *Context, doc interface{}) {
+	sortJSON(v, doc, "$")
+}
+
+// sortJSON orders the members of the objects in the JSON value v at the
+// given path according to o.
+func sortJSON(o CanonicalOrder, v interface{}, path string) {
+	switch v := v.(type) {
+	case jsonObject:
+		sort.SliceStable(v, func(i, j int) bool {
+			pi := replaceIndices(jsonPath(path, v[i].key))
+			pj := replaceIndices(jsonPath(path, v[j].key))
+			return o.less(pi, pj)
+		})
+		for _, m := range v {
+			sortJSON(o, m.value, jsonPath(path, m.key))
+		}
+	case []interface{}:
+		for i, e := range v {
+			sortJSON(o, e, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// jsonPath returns the path of the member key of the object at path,
+// quoting the key as the YAML parser does for mapping keys.
+func jsonPath(path, key string) string {
+	if strings.ContainsAny(key, "$*.[]") {
+		key = "'" + key + "'"
+	}
+	return path + "." + key
+}
+
+// encodeJSON returns the canonical formatting of the JSON value v.
+func encodeJSON(v interface{}) string {
+	var buf strings.Builder
+	writeJSON(&buf, v, "", jsonIndent)
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// compactJSON returns the canonical compact encoding of the JSON value v.
+func compactJSON(v interface{}) string {
+	var buf strings.Builder
+	writeJSON(&buf, v, "", "")
+	return buf.String()
+}
+
+// writeJSON writes the JSON value v to buf. Nested values are written on
+// separate lines with prefix followed by one indent per level, or compactly
+// if indent is empty.
+func writeJSON(buf *strings.Builder, v interface{}, prefix, indent string) {
+	newline, colon := "\n", ": "
+	if indent == "" {
+		newline, colon = "", ":"
+	}
+	switch v := v.(type) {
+	case jsonObject:
+		if len(v) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{" + newline)
+		for i, m := range v {
+			buf.WriteString(prefix + indent)
+			buf.WriteString(jsonString(m.key))
+			buf.WriteString(colon)
+			writeJSON(buf, m.value, prefix+indent, indent)
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(newline)
+		}
+		buf.WriteString(prefix + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		buf.WriteString("[" + newline)
+		for i, e := range v {
+			buf.WriteString(prefix + indent)
+			writeJSON(buf, e, prefix+indent, indent)
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(newline)
+		}
+		buf.WriteString(prefix + "]")
+	case string:
+		buf.WriteString(jsonString(v))
+	case json.Number:
+		buf.WriteString(string(v))
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case nil:
+		buf.WriteString("null")
+	}
+}
+
+// jsonString returns s as a JSON string without HTML escaping.
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	// Encoding a string cannot fail.
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// checkJSONEquivalent returns an error if the formatted JSON source does
+// not hold the same data as orig. Documents embedded in the members named
+// by embedded are compared by their decoded values.
+func checkJSONEquivalent(orig interface{}, formatted string, embedded map[string]bool) error {
+	var got interface{}
+	err := json.Unmarshal([]byte(formatted), &got)
+	if err != nil {
+		return fmt.Errorf("formatted document is invalid: %w", err)
+	}
+	if len(embedded) != 0 {
+		orig = expandEmbedded(orig, embedded)
+		got = expandEmbedded(got, embedded)
+	}
+	path := equivalent(orig, got, "$", nil)
+	if path != "" {
+		return fmt.Errorf("formatting changes value at %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package format
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/google/go-cmp/cmp"
+)
+
+// reverseMembers is a jsonRule that reverses the members of the root
+// object of a JSON document.
+type reverseMembers struct{}
+
+func (reverseMembers) Visitor(*Context) ast.Visitor { return nil }
+
+func (reverseMembers) formatJSON(_ *Context, v interface{}) {
+	if o, ok := v.(jsonObject); ok {
+		for i, j := 0, len(o)-1; i < j; i, j = i+1, j-1 {
+			o[i], o[j] = o[j], o[i]
+		}
+	}
+}
+
+var jsonTests = []struct {
+	name  string
+	in    string
+	rules []Rule
+	want  string
+}{
+	{
+		name:  "indent",
+		in:    `{"a": [1, {"b": null}], "c": {}, "d": []}`,
+		rules: []Rule{CanonicalOrder{}},
+		want: `{
+    "a": [
+        1,
+        {
+            "b": null
+        }
+    ],
+    "c": {},
+    "d": []
+}
+`,
+	},
+	{
+		name:  "trailing_newlines",
+		in:    "{\"a\": true}\n\n\n",
+		rules: []Rule{CanonicalOrder{}},
+		want:  "{\n    \"a\": true\n}\n",
+	},
+	{
+		name:  "lexical_order",
+		in:    `{"message": "m", "event": {"original": "o", "kind": "event"}, "@timestamp": "t"}`,
+		rules: []Rule{CanonicalOrder{}},
+		want: `{
+    "@timestamp": "t",
+    "event": {
+        "kind": "event",
+        "original": "o"
+    },
+    "message": "m"
+}
+`,
+	},
+	{
+		name:  "priority_order",
+		in:    `{"processors": [{"set": {"value": "v", "tag": "t", "field": "f", "if": "c"}}], "description": "d", "on_failure": []}`,
+		rules: []Rule{pipelineOrder},
+		want: `{
+    "description": "d",
+    "processors": [
+        {
+            "set": {
+                "if": "c",
+                "field": "f",
+                "value": "v",
+                "tag": "t"
+            }
+        }
+    ],
+    "on_failure": []
+}
+`,
+	},
+	{
+		name:  "dotted_keys",
+		in:    `{"event.original": 1, "event": 2}`,
+		rules: []Rule{CanonicalOrder{"$.'event.original'": 0}},
+		want: `{
+    "event.original": 1,
+    "event": 2
+}
+`,
+	},
+	{
+		name:  "no_order",
+		in:    `{"b": 1, "a": 2}`,
+		rules: nil,
+		want: `{
+    "b": 1,
+    "a": 2
+}
+`,
+	},
+	{
+		name:  "json_rule",
+		in:    `{"a": 1, "b": 2, "c": 3}`,
+		rules: []Rule{reverseMembers{}, CanonicalQuotes{}},
+		want: `{
+    "c": 3,
+    "b": 2,
+    "a": 1
+}
+`,
+	},
+	{
+		name:  "scalars",
+		in:    `["<tag> & \"quote\"", "é\/", 1.50, -2e10, 0, false]`,
+		rules: []Rule{CanonicalOrder{}},
+		want: `[
+    "<tag> & \"quote\"",
+    "é/",
+    1.50,
+    -2e10,
+    0,
+    false
+]
+`,
+	},
+}
+
+func TestJSON(t *testing.T) {
+	for _, test := range jsonTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(test.name+".json", []byte(test.in), test.rules)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+		})
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		want parseError
+	}{
+		{
+			name: "syntax",
+			in:   "{\n    \"a\": 1,\n    \"b\" 2\n}\n",
+			want: parseError{path: "syntax.json", line: 3, column: 9, msg: "invalid character '2' after object key"},
+		},
+		{
+			name: "trailing",
+			in:   "{}\n{}\n",
+			want: parseError{path: "trailing.json", line: 2, column: 1, msg: "invalid character '{' after top-level value"},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: parseError{path: "empty.json", msg: "unexpected end of JSON input"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := applyChanges(test.name+".json", []byte(test.in), nil)
+			var got *parseError
+			if !errors.As(err, &got) {
+				t.Fatalf("unexpected error: got:%v want:%v", err, test.want)
+			}
+			if *got != test.want {
+				t.Errorf("unexpected error: got:%+v want:%+v", *got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package format
+
+import (
+	"encoding/json"
+
+	"github.com/goccy/go-yaml/ast"
+)
+
+// EmbeddedJSON is a Rule that formats JSON documents embedded as strings
+// in JSON files, such as the panelsJSON, optionsJSON and searchSourceJSON
+// attributes of Kibana saved objects. Each embedded document is decoded,
+// formatted canonically and optionally sorted, and then re-encoded as a
+// compact JSON string or expanded in place.
+//
+// EmbeddedJSON is only applied to JSON files, through its jsonRule
+// implementation. Its Visitor method returns nil, so it is not applied
+// to YAML documents.
+type EmbeddedJSON struct {
+	// Keys is the set of names of the object
+	// members holding embedded documents.
+	Keys []string
+
+	// Sort is whether the members of the objects
+	// in embedded documents are sorted lexically.
+	Sort bool
+
+	// Expand is whether embedded documents are
+	// expanded in place as JSON values rather
+	// than encoded as strings. Expanded documents
+	// are re-encoded as strings when Expand is
+	// false.
+	Expand bool
+}
+
+// KibanaKeys are the names of the attributes of Kibana dashboard saved
+// objects that hold embedded JSON documents.
+var KibanaKeys = []string{"panelsJSON", "optionsJSON", "searchSourceJSON"}
+
+func (EmbeddedJSON) Visitor(*Context) ast.Visitor { return nil }
+
+// formatJSON formats the embedded documents within the JSON document v,
+// recording the member names in ctx for the equivalence check.
+func (e EmbeddedJSON) formatJSON(ctx *Context, v interface{}) {
+	e.format(v)
+	for _, k := range e.Keys {
+		ctx.embedded[k] = true
+	}
+}
+
+// isKey returns whether key names a member holding an embedded document.
+func (e EmbeddedJSON) isKey(key string) bool {
+	for _, k := range e.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// format formats the embedded documents within the JSON value v.
+func (e EmbeddedJSON) format(v interface{}) {
+	switch v := v.(type) {
+	case jsonObject:
+		for i, m := range v {
+			if e.isKey(m.key) {
+				v[i].value = e.formatEmbedded(m.value)
+				continue
+			}
+			e.format(m.value)
+		}
+	case []interface{}:
+		for _, elem := range v {
+			e.format(elem)
+		}
+	}
+}
+
+// formatEmbedded returns the formatted embedded document v. Strings that
+// do not hold valid JSON objects or arrays are returned unaltered.
+func (e EmbeddedJSON) formatEmbedded(v interface{}) interface{} {
+	doc := v
+	if s, ok := v.(string); ok {
+		if !json.Valid([]byte(s)) {
+			return v
+		}
+		var err error
+		doc, err = decodeJSON([]byte(s))
+		if err != nil {
+			return v
+		}
+	}
+	switch doc.(type) {
+	case jsonObject, []interface{}:
+	default:
+		return v
+	}
+	e.format(doc)
+	if e.Sort {
+		sortJSON(CanonicalOrder{}, doc, "$")
+	}
+	if e.Expand {
+		return doc
+	}
+	return compactJSON(doc)
+}
+
+// expandEmbedded returns v with the embedded documents held in members
+// named by keys decoded, as decoded by encoding/json. It is used to
+// compare documents for equivalence.
+func expandEmbedded(v interface{}, keys map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			if s, ok := elem.(string); ok && keys[k] {
+				var doc interface{}
+				if json.Unmarshal([]byte(s), &doc) == nil {
+					switch doc.(type) {
+					case map[string]interface{}, []interface{}:
+						elem = doc
+					}
+				}
+			}
+			v[k] = expandEmbedded(elem, keys)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = expandEmbedded(elem, keys)
+		}
+	}
+	return v
+}
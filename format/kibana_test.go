@@ -0,0 +1,99 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testDashboard = `{"type": "dashboard", "id": "pkg-overview", "attributes": {"title": "Overview", "panelsJSON": "[{\"version\":\"8.3.0\",\"type\":\"lens\",\"gridData\":{\"y\":0,\"x\":0,\"w\":24,\"i\":\"1\",\"h\":15},\"embeddableConfig\":{}}]", "optionsJSON": "{ \"useMargins\": true, \"hidePanelTitles\": false }", "kibanaSavedObjectMeta": {"searchSourceJSON": "{\"query\":{\"query\":\"\",\"language\":\"kuery\"},\"filter\":[]}"}, "description": "not JSON"}}`
+
+var embeddedJSONTests = []struct {
+	name string
+	in   string
+	rule EmbeddedJSON
+	want string
+}{
+	{
+		name: "sort",
+		in:   testDashboard,
+		rule: EmbeddedJSON{Keys: KibanaKeys, Sort: true},
+		want: `{
+    "attributes": {
+        "description": "not JSON",
+        "kibanaSavedObjectMeta": {
+            "searchSourceJSON": "{\"filter\":[],\"query\":{\"language\":\"kuery\",\"query\":\"\"}}"
+        },
+        "optionsJSON": "{\"hidePanelTitles\":false,\"useMargins\":true}",
+        "panelsJSON": "[{\"embeddableConfig\":{},\"gridData\":{\"h\":15,\"i\":\"1\",\"w\":24,\"x\":0,\"y\":0},\"type\":\"lens\",\"version\":\"8.3.0\"}]",
+        "title": "Overview"
+    },
+    "id": "pkg-overview",
+    "type": "dashboard"
+}
+`,
+	},
+	{
+		name: "no_sort",
+		in:   `{"optionsJSON": "{ \"useMargins\": true, \"hidePanelTitles\": false }"}`,
+		rule: EmbeddedJSON{Keys: KibanaKeys},
+		want: `{
+    "optionsJSON": "{\"useMargins\":true,\"hidePanelTitles\":false}"
+}
+`,
+	},
+	{
+		name: "expand",
+		in:   `{"optionsJSON": "{ \"useMargins\": true, \"hidePanelTitles\": false }", "panelsJSON": "[]", "title": "{}"}`,
+		rule: EmbeddedJSON{Keys: KibanaKeys, Sort: true, Expand: true},
+		want: `{
+    "optionsJSON": {
+        "hidePanelTitles": false,
+        "useMargins": true
+    },
+    "panelsJSON": [],
+    "title": "{}"
+}
+`,
+	},
+	{
+		name: "encode_expanded",
+		in:   `{"optionsJSON": {"useMargins": true, "hidePanelTitles": false}}`,
+		rule: EmbeddedJSON{Keys: KibanaKeys},
+		want: `{
+    "optionsJSON": "{\"useMargins\":true,\"hidePanelTitles\":false}"
+}
+`,
+	},
+	{
+		name: "invalid",
+		in:   `{"optionsJSON": "{useMargins: true}", "panelsJSON": "1"}`,
+		rule: EmbeddedJSON{Keys: KibanaKeys},
+		want: `{
+    "optionsJSON": "{useMargins: true}",
+    "panelsJSON": "1"
+}
+`,
+	},
+}
+
+func TestEmbeddedJSON(t *testing.T) {
+	for _, test := range embeddedJSONTests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyChanges(test.name+".json", []byte(test.in), []Rule{test.rule, CanonicalOrder{}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+			again, err := applyChanges(test.name+".json", []byte(got), []Rule{test.rule, CanonicalOrder{}})
+			if err != nil {
+				t.Fatalf("unexpected error formatting result: %v", err)
+			}
+			if again != got {
+				t.Errorf("unstable result:\n--- got\n+++ want\n%s", cmp.Diff(again, got))
+			}
+		})
+	}
+}
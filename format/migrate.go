@@ -0,0 +1,479 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// MigratePipelines converts the JSON ingest pipelines in the data streams
+// of the package rooted at root to YAML, replacing each .json file with a
+// .yml file of the same name.
+//
+// Multi-line Painless scripts and conditions are written as literal block
+// scalars, and the ingest pipeline conventions of the package are applied
+// to the result. References to converted pipelines by name in the pipeline
+// processors of the data stream's other pipelines are updated to name the
+// .yml files. Pipelines that cannot be converted are left unaltered and
+// their errors are returned as a FileErrors. MigratePipelines returns the
+// package-relative paths of the converted pipelines.
+func MigratePipelines(root string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "data_stream", "*", "elasticsearch", "ingest_pipeline", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	rules, err := packageRules(root, true)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert all pipelines before writing any so that references
+	// are only updated for pipelines that are converted.
+	type conversion struct {
+		path, yml string
+		data      string
+		mode      os.FileMode
+	}
+	var (
+		convs   []conversion
+		errs    FileErrors
+		renamed = make(map[string]map[string]string) // Keyed by directory.
+	)
+	for _, path := range paths {
+		yml := strings.TrimSuffix(path, ".json") + ".yml"
+		_, err := os.Stat(yml)
+		if err == nil {
+			errs = append(errs, fmt.Errorf("%s: %s already exists", path, filepath.Base(yml)))
+			continue
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		convs = append(convs, conversion{path: path, yml: yml, mode: fi.Mode().Perm()})
+		dir := filepath.Dir(path)
+		if renamed[dir] == nil {
+			renamed[dir] = make(map[string]string)
+		}
+		renamed[dir][filepath.Base(path)] = filepath.Base(yml)
+	}
+
+	// A failure removes the pipeline from the renamed set, so
+	// convert again until no conversion fails.
+	for failed := true; failed; {
+		failed = false
+		renamers := make(map[string]*pipelineRenamer, len(renamed))
+		for dir, names := range renamed {
+			renamers[dir] = newPipelineRenamer(names)
+		}
+		ok := convs[:0]
+		for _, c := range convs {
+			var src []byte
+			rel, err := filepath.Rel(root, c.yml)
+			if err == nil {
+				src, err = os.ReadFile(c.path)
+			}
+			if err == nil {
+				ctx := newContext(rel, manifest)
+				c.data, err = pipelineYAML(c.path, ctx, src, rules[ctx.Class], renamers[filepath.Dir(c.path)])
+			}
+			if err != nil {
+				errs = append(errs, err)
+				delete(renamed[filepath.Dir(c.path)], filepath.Base(c.path))
+				failed = true
+				continue
+			}
+			ok = append(ok, c)
+		}
+		convs = ok
+	}
+
+	var converted []string
+	for _, c := range convs {
+		err := replaceFile(c.yml, []byte(c.data), c.mode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to write %s: %w", c.yml, err))
+			continue
+		}
+		rel, err := filepath.Rel(root, c.yml)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		converted = append(converted, filepath.ToSlash(rel))
+		err = os.Remove(c.path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Update references in the pipelines that were already YAML.
+	for dir, names := range renamed {
+		if len(names) == 0 {
+			continue
+		}
+		r := newPipelineRenamer(names)
+		paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, path := range paths {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if contains(converted, filepath.ToSlash(rel)) {
+				continue
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			data, err := renamePipelineRefs(path, src, r)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if string(data) == string(src) {
+				continue
+			}
+			err = writeFile(path, data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to write %s: %w", path, err))
+			}
+		}
+	}
+	sort.Strings(converted)
+	if len(errs) != 0 {
+		return converted, errs
+	}
+	return converted, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// pipelineYAML returns the JSON pipeline src converted to YAML with rules
+// applied, and with references to pipelines renamed by r. The file is
+// named path in error messages.
+func pipelineYAML(path string, ctx Context, src []byte, rules []Rule, r *pipelineRenamer) (string, error) {
+	var orig interface{}
+	err := json.Unmarshal(src, &orig)
+	if err != nil {
+		return "", newJSONParseError(path, src, err)
+	}
+	v, err := decodeJSON(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode document %s: %w", path, err)
+	}
+	obj, ok := v.(jsonObject)
+	if !ok {
+		return "", fmt.Errorf("failed to convert document %s: pipeline is not an object", path)
+	}
+	renameJSONRefs(obj, r)
+
+	var buf strings.Builder
+	buf.WriteString("---\n")
+	writeYAML(&buf, obj, "", "")
+	data, _, err := applyRules(path, ctx, []byte(buf.String()), rules, false)
+	if err != nil {
+		return "", err
+	}
+
+	// Check that the conversion is faithful
+	// other than the renamed references.
+	var want, got interface{}
+	err = json.Unmarshal([]byte(encodeJSON(obj)), &want)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert document %s: %w", path, err)
+	}
+	err = yaml.Unmarshal([]byte(data), &got)
+	if err == nil {
+		var b []byte
+		b, err = json.Marshal(got)
+		if err == nil {
+			got = nil
+			err = json.Unmarshal(b, &got)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to convert document %s: converted pipeline is invalid: %w", path, err)
+	}
+	if p := equivalent(want, got, "$", nil); p != "" {
+		return "", fmt.Errorf("failed to convert document %s: conversion changes value at %s", path, p)
+	}
+	return data, nil
+}
+
+// renameJSONRefs replaces the references to pipelines renamed by r in the
+// names of the pipeline processors in v.
+func renameJSONRefs(v interface{}, r *pipelineRenamer) {
+	switch v := v.(type) {
+	case jsonObject:
+		for _, m := range v {
+			if p, ok := m.value.(jsonObject); ok && m.key == "pipeline" {
+				for i, f := range p {
+					if s, ok := f.value.(string); ok && f.key == "name" {
+						p[i].value = r.rename(s)
+					}
+				}
+			}
+			renameJSONRefs(m.value, r)
+		}
+	case []interface{}:
+		for _, e := range v {
+			renameJSONRefs(e, r)
+		}
+	}
+}
+
+// renamePipelineRefs returns the YAML pipeline src with the references to
+// pipelines renamed by r in the names of its pipeline processors replaced.
+// Only the lines holding the names are altered. The file is named path in
+// error messages.
+func renamePipelineRefs(path string, src []byte, r *pipelineRenamer) ([]byte, error) {
+	f, err := parser.ParseBytes(src, 0)
+	if err != nil {
+		return nil, newParseError(path, err)
+	}
+	lines := make(map[int]bool)
+	for _, doc := range f.Docs {
+		ast.Walk(pipelineNames(lines), doc)
+	}
+	if len(lines) == 0 {
+		return src, nil
+	}
+	text := splitLines(string(src))
+	for i := range text {
+		if lines[i+1] {
+			text[i] = r.renameLine(text[i])
+		}
+	}
+	return []byte(strings.Join(text, "")), nil
+}
+
+// pipelineNames is an ast.Visitor that records the lines of the names of
+// pipeline processors.
+type pipelineNames map[int]bool
+
+func (v pipelineNames) Visit(n ast.Node) ast.Visitor {
+	mv, ok := n.(*ast.MappingValueNode)
+	if !ok || mv.Key.String() != "pipeline" {
+		return v
+	}
+	var entries []*ast.MappingValueNode
+	switch p := mv.Value.(type) {
+	case *ast.MappingNode:
+		entries = p.Values
+	case *ast.MappingValueNode:
+		entries = []*ast.MappingValueNode{p}
+	}
+	for _, e := range entries {
+		if e.Key.String() == "name" && e.Value.GetToken() != nil {
+			v[e.Value.GetToken().Position.Line] = true
+		}
+	}
+	return v
+}
+
+// pipelineRenamer renames references to pipeline files in the names of
+// pipeline processors. A name is a reference if it is the file name or the
+// quoted argument of an IngestPipeline template call.
+type pipelineRenamer struct {
+	renamed map[string]string
+
+	// ingest matches IngestPipeline template
+	// calls with a renamed argument.
+	ingest *regexp.Regexp
+
+	// value matches a YAML mapping entry line
+	// with a renamed value.
+	value *regexp.Regexp
+}
+
+// newPipelineRenamer returns a pipelineRenamer replacing the pipeline file
+// names that are keys of renamed with their values.
+func newPipelineRenamer(renamed map[string]string) *pipelineRenamer {
+	names := make([]string, 0, len(renamed))
+	for old := range renamed {
+		names = append(names, regexp.QuoteMeta(old))
+	}
+	sort.Strings(names)
+	alt := "(" + strings.Join(names, "|") + ")"
+	return &pipelineRenamer{
+		renamed: renamed,
+		ingest:  regexp.MustCompile(`(\{\{\s*IngestPipeline\s+\\?")` + alt + `(\\?"\s*\}\})`),
+		value:   regexp.MustCompile(`^(.*:\s+["']?)` + alt + `(["']?\s*(?:#.*)?\r?\n?)$`),
+	}
+}
+
+// rename returns the pipeline name s with references to renamed
+// pipelines replaced.
+func (r *pipelineRenamer) rename(s string) string {
+	if len(r.renamed) == 0 {
+		return s
+	}
+	if new, ok := r.renamed[s]; ok {
+		return new
+	}
+	return r.ingest.ReplaceAllStringFunc(s, r.replace(r.ingest))
+}
+
+// renameLine returns the YAML source line l holding the name of a pipeline
+// processor with references to renamed pipelines replaced.
+func (r *pipelineRenamer) renameLine(l string) string {
+	if len(r.renamed) == 0 {
+		return l
+	}
+	l = r.ingest.ReplaceAllStringFunc(l, r.replace(r.ingest))
+	return r.value.ReplaceAllStringFunc(l, r.replace(r.value))
+}
+
+// replace returns a function replacing the second submatch of matches of
+// re with its renamed name.
+func (r *pipelineRenamer) replace(re *regexp.Regexp) func(string) string {
+	return func(m string) string {
+		sub := re.FindStringSubmatch(m)
+		return sub[1] + r.renamed[sub[2]] + sub[3]
+	}
+}
+
+// painlessKeys is the set of ingest processor options holding Painless
+// source that are written as literal block scalars when multi-line.
+var painlessKeys = map[string]bool{
+	"source": true,
+	"if":     true,
+}
+
+// plainKey matches mapping keys that do not need quoting.
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// writeYAML writes the JSON value v to buf as a YAML block node with the
+// first line prefixed by first and subsequent lines by indent. Strings are
+// written double-quoted to be canonicalised by the formatting rules.
+func writeYAML(buf *strings.Builder, v interface{}, first, indent string) {
+	switch v := v.(type) {
+	case jsonObject:
+		for i, m := range v {
+			prefix := indent
+			if i == 0 {
+				prefix = first
+			}
+			key := m.key
+			if !plainKey.MatchString(key) {
+				key = jsonString(key)
+			}
+			buf.WriteString(prefix + key + ":")
+			if s, ok := m.value.(string); ok && painlessKeys[m.key] && writeLiteral(buf, s, indent+"  ") {
+				continue
+			}
+			writeYAMLValue(buf, m.value, indent+"  ")
+		}
+	case []interface{}:
+		for i, e := range v {
+			prefix := indent
+			if i == 0 {
+				prefix = first
+			}
+			if isCollection(e) {
+				writeYAML(buf, e, prefix+"- ", indent+"  ")
+				continue
+			}
+			buf.WriteString(prefix + "-")
+			writeYAMLValue(buf, e, indent+"  ")
+		}
+	}
+}
+
+// writeYAMLValue writes the JSON value v to buf as the value of a mapping
+// entry or sequence item with nested lines prefixed by indent.
+func writeYAMLValue(buf *strings.Builder, v interface{}, indent string) {
+	if isCollection(v) {
+		buf.WriteString("\n")
+		writeYAML(buf, v, indent, indent)
+		return
+	}
+	buf.WriteString(" ")
+	writeJSON(buf, v, "", "")
+	buf.WriteString("\n")
+}
+
+// isCollection returns whether v is a non-empty JSON object or array.
+func isCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case jsonObject:
+		return len(v) != 0
+	case []interface{}:
+		return len(v) != 0
+	}
+	return false
+}
+
+// writeLiteral writes s to buf as a literal block scalar with its lines
+// prefixed by indent if s is a multi-line string that can be represented
+// as one without an indentation indicator, returning whether it was
+// written.
+func writeLiteral(buf *strings.Builder, s, indent string) bool {
+	if !strings.Contains(strings.TrimRight(s, "\n"), "\n") || strings.Contains(s, "\r") {
+		return false
+	}
+	lines := strings.Split(s, "\n")
+	for _, l := range lines {
+		if l == "" {
+			continue
+		}
+		if strings.HasPrefix(l, " ") {
+			// The first non-empty line would
+			// determine the indentation.
+			return false
+		}
+		break
+	}
+	chomp := "-"
+	switch {
+	case strings.HasSuffix(s, "\n\n"):
+		chomp = "+"
+		lines = lines[:len(lines)-1]
+	case strings.HasSuffix(s, "\n"):
+		chomp = ""
+		lines = lines[:len(lines)-1]
+	}
+	buf.WriteString(" |" + chomp + "\n")
+	for _, l := range lines {
+		if l != "" {
+			buf.WriteString(indent + l)
+		}
+		buf.WriteString("\n")
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package format
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMigratePipelines(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "manifest.yml"), "name: pkg\ntype: integration\n")
+	pipelines := filepath.Join(dir, "data_stream", "log", "elasticsearch", "ingest_pipeline")
+	write(t, filepath.Join(pipelines, "default.json"), `{
+  "description": "Pipeline for logs, see default.json",
+  "processors": [
+    {"script": {"lang": "painless", "tag": "script_1", "source": "def x = ctx.a;\nif (x != null) {\n  ctx.b = x;\n}", "if": "ctx.a != null"}},
+    {"pipeline": {"name": "{{ IngestPipeline \"third.json\" }}"}},
+    {"pipeline": {"name": "{{ IngestPipeline \"not-third.json\" }}"}},
+    {"set": {"field": "event.kind", "value": "event", "if": "ctx.event?.kind == null &&\n  ctx.x != null\n"}}
+  ],
+  "on_failure": [{"set": {"field": "error.message", "value": "{{{ _ingest.on_failure_message }}}"}}]
+}
+`)
+	write(t, filepath.Join(pipelines, "third.json"), `{"processors": [{"remove": {"field": "x", "ignore_missing": true}}]}`)
+	err := os.Chmod(filepath.Join(pipelines, "third.json"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to set test file mode: %v", err)
+	}
+	write(t, filepath.Join(pipelines, "entry.yml"), `---
+description: entry default.json
+processors:
+  - pipeline:
+      name: '{{ IngestPipeline "default.json" }}'
+  - pipeline:
+      name: '{{ IngestPipeline "not-default.json" }}'
+  - pipeline:
+      name: default.json # Entry.
+  - pipeline:
+      name: not-default.json
+`)
+
+	got, err := MigratePipelines(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"data_stream/log/elasticsearch/ingest_pipeline/default.yml",
+		"data_stream/log/elasticsearch/ingest_pipeline/third.yml",
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected converted paths:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+
+	for _, test := range []struct {
+		name string
+		want string
+	}{
+		{
+			name: "default.yml",
+			want: `---
+description: Pipeline for logs, see default.json
+processors:
+  - script:
+      if: ctx.a != null
+      lang: painless
+      source: |-
+        def x = ctx.a;
+        if (x != null) {
+          ctx.b = x;
+        }
+      tag: script_1
+  - pipeline:
+      name: "{{ IngestPipeline \"third.yml\" }}"
+  - pipeline:
+      name: "{{ IngestPipeline \"not-third.json\" }}"
+  - set:
+      if: |
+        ctx.event?.kind == null &&
+          ctx.x != null
+      field: event.kind
+      value: event
+on_failure:
+  - set:
+      field: error.message
+      value: '{{{ _ingest.on_failure_message }}}'
+`,
+		},
+		{
+			name: "third.yml",
+			want: `---
+processors:
+  - remove:
+      field: x
+      ignore_missing: true
+`,
+		},
+		{
+			name: "entry.yml",
+			want: `---
+description: entry default.json
+processors:
+  - pipeline:
+      name: '{{ IngestPipeline "default.yml" }}'
+  - pipeline:
+      name: '{{ IngestPipeline "not-default.json" }}'
+  - pipeline:
+      name: default.yml # Entry.
+  - pipeline:
+      name: not-default.json
+`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join(pipelines, test.name))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := string(b)
+			if got != test.want {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want))
+			}
+		})
+	}
+	for _, name := range []string{"default.json", "third.json"} {
+		_, err := os.Stat(filepath.Join(pipelines, name))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("unexpected stat result for %s: %v", name, err)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(pipelines, "third.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error getting third.yml info: %v", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected mode for third.yml: got:%v want:%v", fi.Mode().Perm(), os.FileMode(0o600))
+	}
+	entries, err := os.ReadDir(pipelines)
+	if err != nil {
+		t.Fatalf("unexpected error reading directory: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("unexpected number of directory entries: got:%d want:3", len(entries))
+	}
+}
+
+func TestMigratePipelinesErrors(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "manifest.yml"), "name: pkg\ntype: integration\n")
+	pipelines := filepath.Join(dir, "data_stream", "log", "elasticsearch", "ingest_pipeline")
+	write(t, filepath.Join(pipelines, "default.json"), `{"processors": [{"pipeline": {"name": "{{ IngestPipeline \"invalid.json\" }}"}}]}`)
+	write(t, filepath.Join(pipelines, "invalid.json"), `{"processors": [}`)
+	write(t, filepath.Join(pipelines, "exists.json"), `{}`)
+	write(t, filepath.Join(pipelines, "exists.yml"), "---\n{}\n")
+
+	got, err := MigratePipelines(dir)
+	var errs FileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("unexpected number of errors: got:%d want:2\n%v", len(errs), err)
+	}
+	want := []string{"data_stream/log/elasticsearch/ingest_pipeline/default.yml"}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected converted paths:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+
+	// References to pipelines that were not
+	// converted must not be renamed.
+	b, err := os.ReadFile(filepath.Join(pipelines, "default.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(b), `invalid.json`) {
+		t.Errorf("unexpected rename of unconverted pipeline reference:\n%s", b)
+	}
+	for _, name := range []string{"invalid.json", "exists.json"} {
+		_, err := os.Stat(filepath.Join(pipelines, name))
+		if err != nil {
+			t.Errorf("unexpected stat result for %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,729 @@
+package format
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"golang.org/x/tools/txtar"
+)
+
+// Mode is the action taken with the result of formatting a package.
+type Mode int
+
+const (
+	Archive Mode = iota // Write a txtar archive of the results.
+	Rewrite             // Write the results to the source files.
+	List                // List the files that would be changed.
+	Diff                // Write unified diffs of the changes.
+	Verify              // Write unified diffs of changes made by a second formatting pass.
+	Report              // Write a JSON report of the result for each file.
+)
+
+// Summary is a summary of the files formatted in one or more packages.
+type Summary struct {
+	Packages        int // packages walked
+	Files           int // files formatted
+	Changed         int // files whose formatting differed
+	ChangedPackages int // packages with files whose formatting differed
+	Unstable        int // files changed by a second formatting pass
+	Failed          int // files that could not be formatted
+}
+
+// Add adds the counts in s to the receiver.
+func (sum *Summary) Add(s Summary) {
+	sum.Packages += s.Packages
+	sum.Files += s.Files
+	sum.Changed += s.Changed
+	sum.ChangedPackages += s.ChangedPackages
+	sum.Unstable += s.Unstable
+	sum.Failed += s.Failed
+}
+
+func (sum Summary) String() string {
+	s := fmt.Sprintf("%d of %d files changed in %d of %d packages", sum.Changed, sum.Files, sum.ChangedPackages, sum.Packages)
+	if sum.Unstable != 0 {
+		s += fmt.Sprintf(", %d files not stable", sum.Unstable)
+	}
+	if sum.Failed != 0 {
+		s += fmt.Sprintf(", %d files failed", sum.Failed)
+	}
+	return s
+}
+
+// FileErrors is a collection of errors from formatting files.
+type FileErrors []error
+
+func (e FileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Pool bounds the number of concurrently executing functions.
+// A nil Pool executes functions synchronously.
+type Pool chan struct{}
+
+// NewPool returns a Pool allowing n concurrently executing functions.
+func NewPool(n int) Pool {
+	return make(Pool, n)
+}
+
+// Do executes fn in a new goroutine when the pool has capacity,
+// blocking until it does.
+func (p Pool) Do(fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	p <- struct{}{}
+	go func() {
+		defer func() { <-p }()
+		fn()
+	}()
+}
+
+// file is a file to be formatted and the result of formatting it.
+type file struct {
+	path  string
+	rel   string
+	rules []Rule
+
+	// ctx is the context for applying
+	// rules to the file's documents.
+	ctx Context
+
+	src  []byte
+	data string
+	err  error
+
+	// second is the result of formatting data
+	// when the file is being verified.
+	second string
+
+	// changedBy is the names of the rules that
+	// altered the file when it is being reported.
+	changedBy []string
+}
+
+// format formats the file according to m, storing the result or error
+// in the file. In verify mode, the result is formatted a second time.
+func (f *file) format(m Mode) {
+	name := DisplayPath(f.path)
+	defer func() {
+		// Failures in goccy/go-yaml should only
+		// affect the file being formatted.
+		if r := recover(); r != nil {
+			f.err = fmt.Errorf("failed to format document %s: internal error: %v", name, r)
+		}
+	}()
+	f.src, f.err = os.ReadFile(f.path)
+	if f.err != nil {
+		return
+	}
+	f.data, f.changedBy, f.err = applyRules(name, f.ctx, f.src, f.rules, m == Report)
+	if f.err != nil || m != Verify {
+		return
+	}
+	f.second, _, f.err = applyRules(name, f.ctx, []byte(f.data), f.rules, false)
+}
+
+// fileReport is the JSON report of the result of formatting a file.
+type fileReport struct {
+	Package   string       `json:"package"`
+	Path      string       `json:"path"`
+	Class     string       `json:"class"`
+	Changed   bool         `json:"changed"`
+	ChangedBy []string     `json:"changed_by,omitempty"`
+	Error     *reportError `json:"error,omitempty"`
+}
+
+// reportError is an error in a fileReport.
+type reportError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// report returns the report for the file in the package pkg.
+func (f *file) report(pkg string) fileReport {
+	r := fileReport{
+		Package:   pkg,
+		Path:      filepath.ToSlash(f.rel),
+		Class:     classFor(f.rel),
+		Changed:   f.err == nil && f.data != string(f.src),
+		ChangedBy: f.changedBy,
+	}
+	if f.err != nil {
+		r.Error = &reportError{Message: f.err.Error()}
+		var perr *parseError
+		if errors.As(f.err, &perr) {
+			r.Error.Message = perr.msg
+			r.Error.Line = perr.line
+			r.Error.Column = perr.column
+		}
+	}
+	return r
+}
+
+// walk does a file-system walk of the package rooted at root
+// applying the rewrite rules corresponding to files relative
+// to the root. Files and directories excluded by ignore are
+// skipped, and nothing is formatted if ignore excludes the
+// package root itself. If include is not nil, only files with relative
+// paths for which include returns true are formatted. Files are
+// formatted concurrently using p, and
+// results are handled in path order according to m; in archive
+// mode a txtar of the result is written to w, in list mode the
+// paths of files that differ from their formatted result are
+// written to w, in diff mode a unified diff of each changed
+// file is written to w and in verify mode a unified diff of the
+// changes made by formatting the result a second time is written
+// to w, and in report mode a JSON report for each file is written
+// to w as a JSON lines stream. Files that cannot be formatted do
+// not prevent formatting of the remaining files; their errors are
+// returned together as a FileErrors, or in report mode, included
+// in the report. walk returns a summary of the files formatted.
+func walk(root string, w io.Writer, rules map[string][]Rule, m Mode, p Pool, ignore ignorer, include func(rel string) bool) (sum Summary, err error) {
+	if ignore.excludesRoot() {
+		return sum, nil
+	}
+	sum.Packages = 1
+	manifest, err := readManifest(root)
+	if err != nil {
+		return sum, err
+	}
+	var files []*file
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root {
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				if ignore.ignored(rel, true) {
+					return fs.SkipDir
+				}
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".yml" && !isTemplate(path) && !isJSON(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if ignore.ignored(rel, false) {
+			return nil
+		}
+		if include != nil && !include(rel) {
+			return nil
+		}
+
+		ctx := newContext(rel, manifest)
+		fileRules, ok := rules[ctx.Class]
+		if !ok {
+			return nil
+		}
+		files = append(files, &file{path: path, rel: rel, rules: fileRules, ctx: ctx})
+		return nil
+	})
+	if err != nil {
+		return sum, err
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range files {
+		f := f
+		wg.Add(1)
+		p.Do(func() {
+			defer wg.Done()
+			f.format(m)
+		})
+	}
+	wg.Wait()
+
+	pkg := filepath.Base(root)
+	var ar txtar.Archive
+	enc := json.NewEncoder(w)
+	var errs FileErrors
+	for _, f := range files {
+		if f.err != nil {
+			sum.Failed++
+			if m != Report {
+				errs = append(errs, f.err)
+				continue
+			}
+			err = enc.Encode(f.report(pkg))
+			if err != nil {
+				return sum, err
+			}
+			continue
+		}
+		differs := f.data != string(f.src)
+		if m == Rewrite && differs {
+			err := writeFile(f.path, []byte(f.data))
+			if err != nil {
+				sum.Failed++
+				errs = append(errs, fmt.Errorf("failed to write %s: %w", f.path, err))
+				continue
+			}
+		}
+		sum.Files++
+		if differs {
+			sum.Changed++
+			sum.ChangedPackages = 1
+		}
+
+		switch m {
+		case Archive:
+			ar.Files = append(ar.Files, txtar.File{
+				Name: filepath.Join(pkg, f.rel),
+				Data: []byte(f.data),
+			})
+		case Rewrite:
+			// Changed files were written above so that
+			// files that fail to be written are not
+			// counted.
+		case List:
+			if differs {
+				_, err := fmt.Fprintln(w, DisplayPath(f.path))
+				if err != nil {
+					return sum, err
+				}
+			}
+		case Diff:
+			name := DisplayPath(f.path)
+			_, err := w.Write(unifiedDiff(name+".orig", f.src, name, []byte(f.data)))
+			if err != nil {
+				return sum, err
+			}
+		case Verify:
+			if f.second != f.data {
+				sum.Unstable++
+				name := DisplayPath(f.path)
+				_, err := w.Write(unifiedDiff(name+".first", []byte(f.data), name+".second", []byte(f.second)))
+				if err != nil {
+					return sum, err
+				}
+			}
+		case Report:
+			err := enc.Encode(f.report(pkg))
+			if err != nil {
+				return sum, err
+			}
+		default:
+			panic(fmt.Sprintf("invalid mode: %d", m))
+		}
+	}
+
+	if m == Archive {
+		_, err = w.Write(txtar.Format(&ar))
+		if err != nil {
+			return sum, err
+		}
+	}
+	if errs != nil {
+		return sum, errs
+	}
+	return sum, nil
+}
+
+// formatStream formats the YAML source read from r as the file at the
+// package-relative path rel in a package with the decoded manifest,
+// writing the result to w. If the file's class has no rules, the source
+// is written unaltered.
+func formatStream(w io.Writer, r io.Reader, rel string, rules map[string][]Rule, manifest map[string]interface{}) (err error) {
+	defer func() {
+		// Failures in goccy/go-yaml should be
+		// reported rather than crash the caller.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to format document %s: internal error: %v", rel, r)
+		}
+	}()
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ctx := newContext(rel, manifest)
+	fileRules, ok := rules[ctx.Class]
+	if !ok {
+		_, err = w.Write(src)
+		return err
+	}
+	data, _, err := applyRules(rel, ctx, src, fileRules, false)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, data)
+	return err
+}
+
+// FindPackages returns the roots of all packages within dir, including
+// dir itself. Hidden directories are not searched and packages are not
+// searched for nested packages. Packages excluded by the ignore files
+// above them are not returned.
+func FindPackages(dir string) ([]string, error) {
+	var roots []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		ok, err := isRootDir(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ignore, err := loadIgnore(path, nil)
+			if err != nil {
+				return err
+			}
+			if !ignore.excludesRoot() {
+				roots = append(roots, path)
+			}
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return roots, err
+}
+
+// writeFile atomically replaces the contents of the file at path with
+// data, preserving the file's permissions. If path is a symbolic link,
+// the link's target is replaced.
+func writeFile(path string, data []byte) (err error) {
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, data, fi.Mode().Perm())
+}
+
+// replaceFile atomically creates or replaces the file at path with data
+// and the permissions perm by writing a temporary file in the same
+// directory and renaming it.
+func replaceFile(path string, data []byte, perm os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".fumpt-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(perm)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// DisplayPath returns path relative to the working directory if path
+// is within it, otherwise path is returned unaltered.
+func DisplayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+var (
+	starDataStream = regexp.MustCompile(`^data_stream/[^/]+/`)
+	starTests      = regexp.MustCompile(`/(pipeline|system)/test-[^/]+-config.yml$`)
+	starFields     = regexp.MustCompile(`(^|/)fields/[^/]+\.yml$`)
+	starPipelines  = regexp.MustCompile(`/ingest_pipeline/[^/]+\.(yml|json)$`)
+	starExpected   = regexp.MustCompile(`/_dev/test/pipeline/[^/]+-expected\.json$`)
+	starDashboards = regexp.MustCompile(`^kibana/dashboard/[^/]+\.json$`)
+	starTemplates  = regexp.MustCompile(`(^|/)agent/(stream|input)/[^/]+\.yml\.hbs$`)
+)
+
+// classFor returns the class of file corresponding to relative path of the
+// file in rel.
+func classFor(rel string) string {
+	class := rel
+	if strings.HasPrefix(class, "data_stream") {
+		class = starDataStream.ReplaceAllString(class, "data_stream/*/")
+	}
+	class = starTests.ReplaceAllString(class, "/*/test-*-config.yml")
+	class = starFields.ReplaceAllString(class, "${1}fields/*.yml")
+	class = starPipelines.ReplaceAllString(class, "/ingest_pipeline/*.${1}")
+	class = starExpected.ReplaceAllString(class, "/_dev/test/pipeline/*-expected.json")
+	class = starDashboards.ReplaceAllString(class, "kibana/dashboard/*.json")
+	class = starTemplates.ReplaceAllString(class, "${1}agent/${2}/*.yml.hbs")
+	return class
+}
+
+// applyChanges applies the changes specified by the rules
+// to src, the contents of the file at path, returning the result
+// of the re-write with a terminal newline. An error is returned if
+// the decoded data of the result differs from the decoded data of
+// src other than by map key ordering or the ordering of sorted lists.
+func applyChanges(path string, src []byte, rules []Rule) (string, error) {
+	data, _, err := applyRules(path, newContext(path, nil), src, rules, false)
+	return data, err
+}
+
+// prepareRules are the rules applied to every document before its
+// blank lines and directives are found. They are not reported as
+// altering the document.
+var prepareRules = []Rule{fixupVisitor{}}
+
+// applyRules implements applyChanges for the file named path in
+// error messages, with the rules applied in the given context. If
+// trace is true, the names of the rules that altered the document
+// are also returned. Handlebars templates are formatted by
+// applyTemplateRules and JSON files by applyJSONRules.
+func applyRules(path string, ctx Context, src []byte, rules []Rule, trace bool) (data string, changedBy []string, err error) {
+	switch {
+	case isTemplate(ctx.Path):
+		return applyTemplateRules(path, ctx, src, rules, trace)
+	case isJSON(ctx.Path):
+		return applyJSONRules(path, ctx, src, rules, trace)
+	}
+	return applyYAMLRules(path, ctx, src, rules, trace, nil)
+}
+
+// applyYAMLRules implements applyRules for YAML source. If protect is
+// not nil, it is called with each document and its directives before
+// the rules are applied to allow nodes to be protected from change.
+func applyYAMLRules(path string, ctx Context, src []byte, rules []Rule, trace bool, protect func(doc ast.Node, d *directives)) (data string, changedBy []string, err error) {
+	file, err := parser.ParseBytes(src, parser.ParseComments)
+	if err != nil {
+		return "", nil, newParseError(path, err)
+	}
+	orig, err := decodeDocs(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode document %s: %w", path, err)
+	}
+	ctx.sortable = make(map[string]bool)
+	changed := make([]bool, len(rules))
+	for _, doc := range file.Docs {
+		ctx.Root = doc
+		ctx.directives = nil
+		for _, r := range prepareRules {
+			ast.Walk(r.Visitor(&ctx), doc)
+		}
+		blank := newFindBlankLines(src)
+		ast.Walk(blank, doc)
+		ctx.directives, err = findDirectives(doc)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to format document %s: %w", path, err)
+		}
+		if protect != nil {
+			protect(doc, ctx.directives)
+		}
+		var prev string
+		if trace {
+			prev = doc.String()
+		}
+		for i, r := range rules {
+			v := r.Visitor(&ctx)
+			if v == nil {
+				continue
+			}
+			ast.Walk(v, doc)
+			if trace {
+				cur := doc.String()
+				if cur != prev {
+					changed[i] = true
+				}
+				prev = cur
+			}
+		}
+		ast.Walk(markBlankLines(blank.marked), doc)
+	}
+	data = restoreBlankLines(file.String())
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	err = checkEquivalent(orig, data, ctx.sortable)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to format document %s: %w", path, err)
+	}
+	for i, c := range changed {
+		if c {
+			changedBy = append(changedBy, ruleName(rules[i]))
+		}
+	}
+	return data, changedBy, nil
+}
+
+// ruleName returns the name of the rule's type.
+func ruleName(r Rule) string {
+	name := fmt.Sprintf("%T", r)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// parseError is a YAML syntax error in a file.
+type parseError struct {
+	path string
+
+	// line and column are the position of the
+	// error, or zero if the position is unknown.
+	line, column int
+
+	msg string
+}
+
+// errPosition matches the position and message in a goccy/go-yaml
+// error message.
+var errPosition = regexp.MustCompile(`^\[(\d+):(\d+)\] (.*)`)
+
+// newParseError returns a parseError for the goccy/go-yaml parse error
+// err in the file at path.
+func newParseError(path string, err error) *parseError {
+	msg := yaml.FormatError(err, false, false)
+	if i := strings.Index(msg, "\n"); i >= 0 {
+		msg = msg[:i]
+	}
+	e := &parseError{path: path, msg: msg}
+	m := errPosition.FindStringSubmatch(msg)
+	if m != nil {
+		e.line, _ = strconv.Atoi(m[1])
+		e.column, _ = strconv.Atoi(m[2])
+		e.msg = m[3]
+	}
+	return e
+}
+
+func (e *parseError) Error() string {
+	if e.line == 0 {
+		return fmt.Sprintf("failed to parse document %s: %s", e.path, e.msg)
+	}
+	return fmt.Sprintf("failed to parse document %s:%d:%d: %s", e.path, e.line, e.column, e.msg)
+}
+
+// FileRoot returns the root of the package containing the file at path
+// and the path of the file relative to the root.
+func FileRoot(path string) (pkgRoot, rel string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	r, err := Root(filepath.Dir(abs))
+	if err != nil {
+		return "", "", err
+	}
+	rel, err = filepath.Rel(r, abs)
+	if err != nil {
+		return "", "", err
+	}
+	return r, rel, nil
+}
+
+// Root returns the root of the package containing the directory dir. If
+// dir is not within a package, os.ErrNotExist is returned.
+func Root(dir string) (string, error) {
+	d, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		ok, err := isRootDir(d)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return d, nil
+		}
+		if d == "/" {
+			return "", os.ErrNotExist
+		}
+		d = filepath.Dir(d)
+	}
+}
+
+var typePath = mustPath(yaml.PathString("$.type"))
+
+// packageTypes is the set of Fleet package types.
+var packageTypes = map[string]bool{
+	"integration": true,
+	"input":       true,
+	"content":     true,
+}
+
+// isRootDir returns whether dir is a fleet package root directory.
+func isRootDir(dir string) (ok bool, err error) {
+	typ, err := packageType(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return packageTypes[typ], err
+}
+
+// packageType returns the type of the package declared in the manifest
+// in dir. If dir has no manifest, os.ErrNotExist is returned. If the
+// manifest has no type, the empty string is returned.
+func packageType(dir string) (string, error) {
+	p := filepath.Join(dir, "manifest.yml")
+
+	_, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := parser.ParseFile(p, 0)
+	if err != nil {
+		return "", err
+	}
+	n, err := typePath.FilterFile(f)
+	switch {
+	case errors.Is(err, yaml.ErrNotFoundNode):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	return n.String(), nil
+}
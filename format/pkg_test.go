@@ -0,0 +1,476 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/tools/txtar"
+)
+
+var update = flag.Bool("update", false, "update test expectations")
+
+func TestRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get wd: %v", err)
+	}
+
+	for _, pkg := range []string{"pkg", "input_pkg"} {
+		pkgPath := filepath.Join("testdata", pkg)
+		err = filepath.WalkDir(pkgPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			got, err := Root(path)
+			if d.IsDir() {
+				if err != nil {
+					t.Errorf("unexpected error for %s: %v", path, err)
+				}
+				got, err := filepath.Rel(wd, got)
+				if err != nil {
+					t.Fatalf("failed to get relative path: %v", err)
+				}
+				if got != pkgPath {
+					t.Errorf("unexpected root path for %s: got:%v want:%s", path, got, pkgPath)
+				}
+			} else {
+				if err == nil {
+					t.Errorf("expected error for %s: %v", path, err)
+				}
+				if got != "" {
+					t.Errorf("unexpected root path for non-directory %s: got:%v", path, got)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("unexpected error during walk: %v", err)
+		}
+	}
+}
+
+var walkTests = []struct {
+	pkg  string
+	want string
+}{
+	{pkg: "pkg", want: "pkg_want.txtar"},
+	{pkg: "input_pkg", want: "input_pkg_want.txtar"},
+}
+
+func TestWalk(t *testing.T) {
+	for _, test := range walkTests {
+		t.Run(test.pkg, func(t *testing.T) {
+			pkgPath := filepath.Join("testdata", test.pkg)
+			typ, err := packageType(pkgPath)
+			if err != nil {
+				t.Fatalf("unexpected error getting package type: %v", err)
+			}
+			var buf bytes.Buffer
+			_, err = walk(pkgPath, &buf, PackageConventions[typ], Archive, NewPool(4), nil, nil)
+			if err != nil {
+				t.Errorf("unexpected error during walk: %v", err)
+			}
+			if *update {
+				err = os.WriteFile(test.want, buf.Bytes(), 0o644)
+				if err != nil {
+					t.Errorf("unexpected error writing testdata: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(test.want)
+			if err != nil {
+				t.Errorf("unexpected error reading testdata: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(buf.Bytes(), want))
+			}
+		})
+	}
+}
+
+func TestWalkList(t *testing.T) {
+	var buf bytes.Buffer
+	sum, err := walk("testdata/pkg", &buf, Conventions, List, nil, nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error during walk: %v", err)
+	}
+	wantSum := Summary{Packages: 1, Files: 14, Changed: 13, ChangedPackages: 1}
+	if sum != wantSum {
+		t.Errorf("unexpected summary: got:%+v want:%+v", sum, wantSum)
+	}
+	want := []string{
+		"testdata/pkg/changelog.yml",
+		"testdata/pkg/data_stream/log/_dev/test/pipeline/test-log.log-expected.json",
+		"testdata/pkg/data_stream/log/_dev/test/system/test-logfile-config.yml",
+		"testdata/pkg/data_stream/log/_dev/test/system/test-udp-config.yml",
+		"testdata/pkg/data_stream/log/agent/stream/stream.yml.hbs",
+		"testdata/pkg/data_stream/log/agent/stream/udp.yml.hbs",
+		"testdata/pkg/data_stream/log/elasticsearch/ingest_pipeline/default.yml",
+		"testdata/pkg/data_stream/log/fields/agent.yml",
+		"testdata/pkg/data_stream/log/fields/ecs.yml",
+		"testdata/pkg/data_stream/log/manifest.yml",
+		"testdata/pkg/data_stream/log/sample_event.json",
+		"testdata/pkg/kibana/dashboard/pkg-overview.json",
+		"testdata/pkg/manifest.yml",
+	}
+	for i, p := range want {
+		want[i] = filepath.FromSlash(p)
+	}
+	got := strings.Fields(buf.String())
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestFindPackages(t *testing.T) {
+	got, err := FindPackages("testdata")
+	if err != nil {
+		t.Fatalf("unexpected error finding packages: %v", err)
+	}
+	want := []string{
+		filepath.Join("testdata", "input_pkg"),
+		filepath.Join("testdata", "pkg"),
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestWalkVerify(t *testing.T) {
+	for _, test := range walkTests {
+		t.Run(test.pkg, func(t *testing.T) {
+			pkgPath := filepath.Join("testdata", test.pkg)
+			typ, err := packageType(pkgPath)
+			if err != nil {
+				t.Fatalf("unexpected error getting package type: %v", err)
+			}
+			var buf bytes.Buffer
+			sum, err := walk(pkgPath, &buf, PackageConventions[typ], Verify, nil, nil, nil)
+			if err != nil {
+				t.Errorf("unexpected error during walk: %v", err)
+			}
+			if sum.Unstable != 0 {
+				t.Errorf("unexpected unstable formatting:\n%s", &buf)
+			}
+		})
+	}
+}
+
+// toggleQuotes is a Rule that is not idempotent.
+type toggleQuotes struct{}
+
+func (v toggleQuotes) Visitor(*Context) ast.Visitor { return v }
+
+func (v toggleQuotes) Visit(n ast.Node) ast.Visitor {
+	if n, ok := n.(*ast.StringNode); ok {
+		switch n.Token.Type {
+		case token.SingleQuoteType:
+			n.Token.Type = token.DoubleQuoteType
+		case token.DoubleQuoteType:
+			n.Token.Type = token.SingleQuoteType
+		}
+	}
+	return v
+}
+
+func TestWalkVerifyUnstable(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "test.yml"), []byte("key: 'value'\n"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	rules := map[string][]Rule{"test.yml": {toggleQuotes{}}}
+	var buf bytes.Buffer
+	sum, err := walk(dir, &buf, rules, Verify, nil, nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error during walk: %v", err)
+	}
+	if sum.Unstable != 1 {
+		t.Errorf("unexpected number of unstable files: got:%d want:1", sum.Unstable)
+	}
+	name := DisplayPath(filepath.Join(dir, "test.yml"))
+	want := "--- " + name + ".first\n+++ " + name + ".second\n@@ -1 +1 @@\n-key: \"value\"\n+key: 'value'\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestFormatStream(t *testing.T) {
+	const rel = "data_stream/log/fields/ecs.yml"
+	src, err := os.ReadFile(filepath.Join("testdata", "pkg", filepath.FromSlash(rel)))
+	if err != nil {
+		t.Fatalf("unexpected error reading testdata: %v", err)
+	}
+	ar, err := txtar.ParseFile("pkg_want.txtar")
+	if err != nil {
+		t.Fatalf("unexpected error reading testdata: %v", err)
+	}
+	var want []byte
+	for _, f := range ar.Files {
+		if f.Name == "pkg/"+rel {
+			want = f.Data
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	err = formatStream(&buf, bytes.NewReader(src), rel, Conventions, nil)
+	if err != nil {
+		t.Errorf("unexpected error formatting stream: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(buf.String(), string(want)))
+	}
+
+	buf.Reset()
+	err = formatStream(&buf, bytes.NewReader(src), "unknown.yml", Conventions, nil)
+	if err != nil {
+		t.Errorf("unexpected error formatting stream: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), src) {
+		t.Errorf("unexpected result for unclassified file:\n--- got\n+++ want\n%s", cmp.Diff(buf.String(), string(src)))
+	}
+}
+
+func TestWalkInclude(t *testing.T) {
+	p := filepath.Join("testdata", "pkg", "data_stream", "log", "fields", "ecs.yml")
+	r, rel, err := FileRoot(p)
+	if err != nil {
+		t.Fatalf("unexpected error finding file root: %v", err)
+	}
+	wantRel := filepath.Join("data_stream", "log", "fields", "ecs.yml")
+	if rel != wantRel {
+		t.Errorf("unexpected relative path: got:%s want:%s", rel, wantRel)
+	}
+	var buf bytes.Buffer
+	sum, err := walk(r, &buf, Conventions, List, nil, nil, func(path string) bool { return path == rel })
+	if err != nil {
+		t.Errorf("unexpected error during walk: %v", err)
+	}
+	if sum.Files != 1 {
+		t.Errorf("unexpected number of files formatted: got:%d want:1", sum.Files)
+	}
+	if got, want := buf.String(), DisplayPath(p)+"\n"; got != want {
+		t.Errorf("unexpected result: got:%q want:%q", got, want)
+	}
+}
+
+func TestWalkReport(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"bad.yml":  "key: value\n{a: 1\n",
+		"good.yml": "b: \"value\"\na: 1\n",
+		"same.yml": "a: 1\n",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	visitors := []Rule{CanonicalQuotes{}, CanonicalOrder{}}
+	rules := map[string][]Rule{"bad.yml": visitors, "good.yml": visitors, "same.yml": visitors}
+	var buf bytes.Buffer
+	_, err := walk(dir, &buf, rules, Report, nil, nil, nil)
+	if err != nil {
+		t.Errorf("unexpected error during walk: %v", err)
+	}
+	pkg := filepath.Base(dir)
+	want := `{"package":"` + pkg + `","path":"bad.yml","class":"bad.yml","changed":false,"error":{"message":"unterminated flow mapping","line":2,"column":1}}
+{"package":"` + pkg + `","path":"good.yml","class":"good.yml","changed":true,"changed_by":["CanonicalQuotes","CanonicalOrder"]}
+{"package":"` + pkg + `","path":"same.yml","class":"same.yml","changed":false}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"a.yml": "a: 1\n  b: 2\n",
+		"b.yml": "b: \"value\"\n",
+		"c.yml": "- a\n b\n-c: :\n", // Causes a panic in goccy/go-yaml.
+		"d.yml": "{a: 1\n",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+	}
+	visitors := []Rule{CanonicalQuotes{}}
+	rules := map[string][]Rule{"a.yml": visitors, "b.yml": visitors, "c.yml": visitors, "d.yml": visitors}
+	var buf bytes.Buffer
+	sum, err := walk(dir, &buf, rules, List, nil, nil, nil)
+	var errs FileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("unexpected error type: %T", err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("unexpected number of errors: got:%d want:3\n%v", len(errs), err)
+	}
+	var perr *parseError
+	if !errors.As(errs[0], &perr) || perr.line != 1 || perr.column != 4 {
+		t.Errorf("unexpected first error: %#v", errs[0])
+	}
+	wantSum := Summary{Packages: 1, Files: 1, Changed: 1, ChangedPackages: 1, Failed: 3}
+	if sum != wantSum {
+		t.Errorf("unexpected summary: got:%+v want:%+v", sum, wantSum)
+	}
+	if got, want := buf.String(), DisplayPath(filepath.Join(dir, "b.yml"))+"\n"; got != want {
+		t.Errorf("unexpected result: got:%q want:%q", got, want)
+	}
+}
+
+// removeFile is a Rule that removes the file being formatted from dir,
+// causing it to fail to be written.
+type removeFile struct {
+	t   *testing.T
+	dir string
+}
+
+func (r removeFile) Visitor(ctx *Context) ast.Visitor {
+	err := os.Remove(filepath.Join(r.dir, ctx.Path))
+	if err != nil {
+		r.t.Errorf("failed to remove %s: %v", ctx.Path, err)
+	}
+	return nil
+}
+
+func TestWalkRewriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.yml", "b.yml", "c.yml"} {
+		write(t, filepath.Join(dir, name), "a: 'value'\n")
+	}
+
+	visitors := []Rule{CanonicalQuotes{}}
+	rules := map[string][]Rule{
+		"a.yml": {removeFile{t: t, dir: dir}, CanonicalQuotes{}},
+		"b.yml": visitors,
+		"c.yml": {removeFile{t: t, dir: dir}, CanonicalQuotes{}},
+	}
+	sum, err := walk(dir, nil, rules, Rewrite, nil, nil, nil)
+	var errs FileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("unexpected error type: %T: %v", err, err)
+	}
+	if len(errs) != 2 || sum.Failed != 2 {
+		t.Errorf("unexpected failures: got:%d errors and %d failed files want:2", len(errs), sum.Failed)
+	}
+	if sum.Files != 1 || sum.Changed != 1 {
+		t.Errorf("unexpected summary: got:%d files and %d changed want:1", sum.Files, sum.Changed)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "b.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error reading b.yml: %v", err)
+	}
+	if string(got) != "a: value\n" {
+		t.Errorf("unexpected result for b.yml: got:%q want:%q", got, "a: value\n")
+	}
+}
+
+func TestWalkRewrite(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{name: "changed.yml", data: "b: \"value\"\n", perm: 0o600},
+		{name: "exec.yml", data: "c: 'value'\n", perm: 0o755},
+		{name: "same.yml", data: "a: value\n", perm: 0o644},
+	} {
+		path := filepath.Join(dir, f.name)
+		err := os.WriteFile(path, []byte(f.data), f.perm)
+		if err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		// Ensure permissions are not masked.
+		err = os.Chmod(path, f.perm)
+		if err != nil {
+			t.Fatalf("failed to set test file mode: %v", err)
+		}
+	}
+	err := os.Symlink("same.yml", filepath.Join(dir, "link.yml"))
+	if err != nil {
+		t.Fatalf("failed to make symbolic link: %v", err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(filepath.Join(dir, "same.yml"), old, old)
+	if err != nil {
+		t.Fatalf("failed to set test file time: %v", err)
+	}
+
+	visitors := []Rule{CanonicalQuotes{}}
+	rules := map[string][]Rule{"changed.yml": visitors, "exec.yml": visitors, "same.yml": visitors, "link.yml": visitors}
+	_, err = walk(dir, nil, rules, Rewrite, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error during walk: %v", err)
+	}
+
+	for _, f := range []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{name: "changed.yml", data: "b: value\n", perm: 0o600},
+		{name: "exec.yml", data: "c: value\n", perm: 0o755},
+		{name: "same.yml", data: "a: value\n", perm: 0o644},
+	} {
+		path := filepath.Join(dir, f.name)
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("unexpected error reading %s: %v", f.name, err)
+			continue
+		}
+		if string(got) != f.data {
+			t.Errorf("unexpected result for %s: got:%q want:%q", f.name, got, f.data)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("unexpected error getting %s info: %v", f.name, err)
+			continue
+		}
+		if fi.Mode().Perm() != f.perm {
+			t.Errorf("unexpected mode for %s: got:%v want:%v", f.name, fi.Mode().Perm(), f.perm)
+		}
+		if f.name == "same.yml" && !fi.ModTime().Equal(old) {
+			t.Errorf("unexpected modification of unchanged file: got:%v want:%v", fi.ModTime(), old)
+		}
+	}
+	fi, err := os.Lstat(filepath.Join(dir, "link.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error getting link info: %v", err)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("symbolic link was replaced")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading directory: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("unexpected number of directory entries: got:%d want:4", len(entries))
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatalf("failed to make directory: %v", err)
+	}
+	err = os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
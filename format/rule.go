@@ -0,0 +1,99 @@
+package format
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// Rule is a formatting rule. A Rule is applied to each document in a file
+// by walking the document with the ast.Visitor returned by its Visitor
+// method.
+type Rule interface {
+	// Visitor returns the visitor that applies the
+	// rule to the document described by ctx. If it
+	// returns nil, the rule is not applied.
+	Visitor(ctx *Context) ast.Visitor
+}
+
+// jsonRule is a Rule that is also applied to JSON files. The rules of a
+// JSON file's class that do not implement jsonRule are not applied to it.
+type jsonRule interface {
+	Rule
+
+	// formatJSON applies the rule in place to
+	// the decoded JSON document v described by
+	// ctx.
+	formatJSON(ctx *Context, v interface{})
+}
+
+// Context is the context in which a rule is applied to a document.
+type Context struct {
+	// Root is the root node of the document
+	// being formatted.
+	Root ast.Node
+
+	// Path is the slash-separated package-relative
+	// path of the file being formatted.
+	Path string
+
+	// Class is the file class of the file being
+	// formatted.
+	Class string
+
+	// Manifest is the decoded package manifest,
+	// or nil if it is not available.
+	Manifest map[string]interface{}
+
+	// directives is the set of rules disabled in
+	// the document by comment directives.
+	directives *directives
+
+	// sortable is used to record the paths of
+	// sorted lists with indices replaced with
+	// "[*]".
+	sortable map[string]bool
+
+	// embedded is used to record the names of
+	// JSON object members holding embedded
+	// documents, which are compared by their
+	// decoded values.
+	embedded map[string]bool
+}
+
+// newContext returns a Context for the file at the package-relative path
+// rel in a package with the given decoded manifest.
+func newContext(rel string, manifest map[string]interface{}) Context {
+	rel = filepath.ToSlash(rel)
+	return Context{Path: rel, Class: classFor(rel), Manifest: manifest}
+}
+
+// directed returns v wrapped so that it is not applied where the rule
+// with the directive name rule is disabled by comment directives.
+func (ctx *Context) directed(rule string, v ast.Visitor) ast.Visitor {
+	if ctx.directives == nil {
+		return v
+	}
+	return directed{rule: rule, v: v, directives: ctx.directives}
+}
+
+// readManifest returns the decoded manifest of the package rooted at
+// root. If root has no manifest, nil is returned.
+func readManifest(root string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(filepath.Join(root, "manifest.yml"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = yaml.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
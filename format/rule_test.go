@@ -0,0 +1,63 @@
+package format
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordContext is a Rule that records the context it is applied in.
+type recordContext struct {
+	mu   *sync.Mutex
+	seen map[string]Context
+}
+
+func (r recordContext) Visitor(ctx *Context) ast.Visitor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ctx.Root == nil {
+		panic("no document root")
+	}
+	c := *ctx
+	c.Root = nil
+	c.directives = nil
+	c.sortable = nil
+	r.seen[ctx.Path] = c
+	return nil
+}
+
+func TestRuleContext(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "manifest.yml"), "name: pkg\ntype: integration\n")
+	write(t, filepath.Join(dir, "data_stream", "log", "manifest.yml"), "title: Log\n")
+
+	rule := recordContext{mu: &sync.Mutex{}, seen: make(map[string]Context)}
+	rules := map[string][]Rule{
+		"manifest.yml":               {rule},
+		"data_stream/*/manifest.yml": {rule},
+	}
+	_, err := walk(dir, nil, rules, List, NewPool(2), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error during walk: %v", err)
+	}
+
+	manifest := map[string]interface{}{"name": "pkg", "type": "integration"}
+	want := map[string]Context{
+		"manifest.yml": {
+			Path:     "manifest.yml",
+			Class:    "manifest.yml",
+			Manifest: manifest,
+		},
+		"data_stream/log/manifest.yml": {
+			Path:     "data_stream/log/manifest.yml",
+			Class:    "data_stream/*/manifest.yml",
+			Manifest: manifest,
+		},
+	}
+	if !cmp.Equal(rule.seen, want, cmp.AllowUnexported(Context{})) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(rule.seen, want, cmp.AllowUnexported(Context{})))
+	}
+}
@@ -0,0 +1,275 @@
+package format
+
+import (
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// PackageConventions contains the conventions for each Fleet package type.
+var PackageConventions = map[string]map[string][]Rule{
+	"integration": Conventions,
+	"input":       InputConventions,
+	"content":     ContentConventions,
+}
+
+// Conventions contains the specific conventions for file classes in an
+// integration package.
+var Conventions = map[string][]Rule{
+	"_dev/build/build.yml": {
+		CanonicalQuotes{},
+	},
+
+	"changelog.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"$[*].version":                0,
+			"$[*].changes":                1,
+			"$[*].changes[*].description": 0,
+			"$[*].changes[*].type":        1,
+			"$[*].changes[*].link":        2,
+		},
+	},
+	"manifest.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"*.name":        0,
+			"*.title":       1,
+			"$.version":     2,
+			"$.release":     3,
+			"*.description": 4,
+			"$.owner":       -1,
+		},
+	},
+
+	"data_stream/*/_dev/test/*/test-*-config.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"$.service":     0,
+			"$.input":       1,
+			"$.data_stream": 2,
+		},
+	},
+	"data_stream/*/elasticsearch/ingest_pipeline/*.yml": {
+		CanonicalQuotes{},
+		pipelineOrder,
+	},
+	"data_stream/*/elasticsearch/ingest_pipeline/*.json": {
+		pipelineOrder,
+	},
+	"data_stream/*/sample_event.json": {
+		CanonicalOrder{},
+	},
+	"data_stream/*/_dev/test/pipeline/*-expected.json": {
+		CanonicalOrder{},
+	},
+	"kibana/dashboard/*.json": {
+		EmbeddedJSON{Keys: KibanaKeys, Sort: true},
+		CanonicalOrder{},
+	},
+	"data_stream/*/fields/*.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"*.name":        0,
+			"*.type":        1,
+			"*.level":       2,
+			"*.description": 3,
+			"*.example":     -1,
+		},
+		SortLists{
+			CanSort: IsECSGroup,
+			Less:    LessByName,
+		},
+	},
+	"data_stream/*/manifest.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"*.name":        0,
+			"*.title":       1,
+			"*.type":        2,
+			"*.description": 3,
+			"*.required":    4,
+			"*.show_user":   5,
+			"*.multi":       6,
+			"*.default":     -1,
+		},
+	},
+	"data_stream/*/agent/stream/*.yml.hbs": {
+		CanonicalQuotes{},
+	},
+}
+
+// pipelineOrder is the ordering of ingest pipelines in YAML and JSON.
+// Processor parameters are ordered with the description and condition
+// first, then field and target_field, then the options specific to the
+// processor type in the order given by processorOptions, then unknown
+// options lexically, and finally the common failure handling parameters.
+var pipelineOrder = newPipelineOrder(processorOptions)
+
+// processorOptions holds the options specific to each Elasticsearch
+// ingest processor type in their canonical order. The field, target_field
+// and common processor parameters are ordered by pipelineOrder for all
+// processor types, and so are not included.
+var processorOptions = map[string][]string{
+	"append":            {"value", "allow_duplicates", "media_type"},
+	"attachment":        {"indexed_chars", "indexed_chars_field", "properties", "remove_binary", "resource_name"},
+	"circle":            {"error_distance", "shape_type"},
+	"community_id":      {"source_ip", "source_port", "destination_ip", "destination_port", "iana_number", "icmp_type", "icmp_code", "transport", "seed"},
+	"convert":           {"type"},
+	"csv":               {"target_fields", "separator", "quote", "trim", "empty_value"},
+	"date":              {"formats", "timezone", "locale", "output_format"},
+	"date_index_name":   {"index_name_prefix", "date_rounding", "date_formats", "timezone", "locale", "index_name_format"},
+	"dissect":           {"pattern", "append_separator"},
+	"dot_expander":      {"path", "override"},
+	"enrich":            {"policy_name", "override", "max_matches", "shape_relation"},
+	"fail":              {"message"},
+	"fingerprint":       {"fields", "salt", "method"},
+	"foreach":           {"processor"},
+	"geo_grid":          {"tile_type", "parent_field", "children_field", "non_children_field", "precision_field", "target_format"},
+	"geoip":             {"database_file", "properties", "first_only", "download_database_on_pipeline_creation"},
+	"grok":              {"patterns", "pattern_definitions", "ecs_compatibility", "trace_match"},
+	"gsub":              {"pattern", "replacement"},
+	"inference":         {"model_id", "input_output", "field_map", "inference_config"},
+	"join":              {"separator"},
+	"json":              {"add_to_root", "add_to_root_conflict_strategy", "allow_duplicate_keys", "strict_json_parsing"},
+	"kv":                {"field_split", "value_split", "include_keys", "exclude_keys", "prefix", "trim_key", "trim_value", "strip_brackets"},
+	"network_direction": {"source_ip", "destination_ip", "internal_networks", "internal_networks_field"},
+	"pipeline":          {"name", "ignore_missing_pipeline"},
+	"redact":            {"patterns", "pattern_definitions", "prefix", "suffix", "skip_if_unlicensed"},
+	"remove":            {"keep"},
+	"rename":            {"override"},
+	"reroute":           {"destination", "dataset", "namespace"},
+	"script":            {"lang", "id", "source", "params"},
+	"set":               {"value", "copy_from", "override", "ignore_empty_value", "media_type"},
+	"set_security_user": {"properties"},
+	"sort":              {"order"},
+	"split":             {"separator", "preserve_trailing"},
+	"uri_parts":         {"keep_original", "remove_if_successful"},
+	"user_agent":        {"regex_file", "properties", "extract_device_type"},
+}
+
+// newPipelineOrder returns the ingest pipeline ordering with the processor
+// type specific options in options.
+func newPipelineOrder(options map[string][]string) CanonicalOrder {
+	o := CanonicalOrder{
+		"*.description":    0,
+		"*.if":             1,
+		"*.field":          2,
+		"*.target_field":   3,
+		"*.ignore_missing": -5,
+		"*.ignore_failure": -4,
+		"*.tag":            -3,
+		"*.tags":           -2,
+		"*.on_failure":     -1,
+	}
+	for typ, opts := range options {
+		for i, opt := range opts {
+			o["*."+typ+"."+opt] = 4 + i
+		}
+	}
+	return o
+}
+
+// InputConventions contains the specific conventions for file classes in
+// an input package. Input packages have no data streams, so tests and
+// field definitions are held at the package root, and the input's
+// variables are declared in the package manifest's policy templates.
+var InputConventions = map[string][]Rule{
+	"_dev/build/build.yml": Conventions["_dev/build/build.yml"],
+	"changelog.yml":        Conventions["changelog.yml"],
+	"manifest.yml": {
+		CanonicalQuotes{},
+		CanonicalOrder{
+			"*.name":        0,
+			"*.title":       1,
+			"$.version":     2,
+			"$.release":     3,
+			"*.description": 4,
+			"$.owner":       -1,
+
+			"$.policy_templates[*].vars[*].type":      2,
+			"$.policy_templates[*].vars[*].required":  5,
+			"$.policy_templates[*].vars[*].show_user": 6,
+			"$.policy_templates[*].vars[*].multi":     7,
+			"$.policy_templates[*].vars[*].default":   -1,
+		},
+	},
+
+	"_dev/test/*/test-*-config.yml": Conventions["data_stream/*/_dev/test/*/test-*-config.yml"],
+	"fields/*.yml":                  Conventions["data_stream/*/fields/*.yml"],
+	"agent/input/*.yml.hbs":         Conventions["data_stream/*/agent/stream/*.yml.hbs"],
+	"sample_event.json":             Conventions["data_stream/*/sample_event.json"],
+}
+
+// ContentConventions contains the specific conventions for file classes in
+// a content package.
+var ContentConventions = map[string][]Rule{
+	"_dev/build/build.yml": Conventions["_dev/build/build.yml"],
+	"changelog.yml":        Conventions["changelog.yml"],
+	"manifest.yml":         Conventions["manifest.yml"],
+
+	"kibana/dashboard/*.json": Conventions["kibana/dashboard/*.json"],
+}
+
+// IsECSGroup returns whether the node n is in a 'type: group' field.
+func IsECSGroup(root ast.Node, n *ast.SequenceNode) bool {
+	owner := up(2, root, n)
+	if owner == nil {
+		// We can sort root lists.
+		return up(1, root, n) == root
+	}
+	m, ok := owner.(*ast.MappingNode)
+	if ok {
+		for _, v := range m.Values {
+			if v.Key.String() != "type" {
+				continue
+			}
+			return v.Value.String() == "group"
+		}
+	}
+	return false
+}
+
+// up returns the n-parent of child if it exists in the AST, or nil otherwise.
+func up(n int, root, child ast.Node) ast.Node {
+	for i := 0; i < n; i++ {
+		prev := child
+		child = ast.Parent(root, child)
+		if child == prev {
+			return nil
+		}
+	}
+	return child
+}
+
+var namePath = mustPath(yaml.PathString("$.name"))
+
+// LessByName returns whether the path of a is lexically less than
+// the path of b, breaking ties by source order.
+func LessByName(a, b ast.Node) bool {
+	// Get name node.
+	an, _ := namePath.FilterNode(a)
+	bn, _ := namePath.FilterNode(b)
+	switch {
+	case an != nil && bn != nil:
+		// Order lexically.
+		return an.String() < bn.String()
+	case an != nil:
+		// Only the a node has a name so sort it first.
+		return true
+	case bn != nil:
+		// Only the b node has a name so sort it first.
+		return false
+	default:
+		// Fall back to source order.
+		at := a.GetToken()
+		bt := b.GetToken()
+		switch {
+		case at.Position.Line < bt.Position.Line:
+			return true
+		case at.Position.Line > bt.Position.Line:
+			return false
+		default:
+			return at.Position.Column < bt.Position.Column
+		}
+	}
+}
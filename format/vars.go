@@ -0,0 +1,407 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// VarIssue is a problem with a variable referenced by a Handlebars
+// template or declared in a manifest.
+type VarIssue struct {
+	// Path is the slash-separated package-relative
+	// path of the template referencing the variable
+	// or the manifest declaring it.
+	Path string
+
+	// Line is the line of the reference or
+	// declaration, or zero if it is not known.
+	Line int
+
+	// Name is the name of the variable.
+	Name string
+
+	// Undefined is whether the variable is referenced
+	// by the template but is not declared. Otherwise
+	// the variable is declared but not referenced.
+	Undefined bool
+}
+
+func (i VarIssue) String() string {
+	pos := i.Path
+	if i.Line != 0 {
+		pos = fmt.Sprintf("%s:%d", i.Path, i.Line)
+	}
+	if i.Undefined {
+		return fmt.Sprintf("%s: undefined variable %q", pos, i.Name)
+	}
+	return fmt.Sprintf("%s: unused variable %q", pos, i.Name)
+}
+
+// CheckVars checks the variables referenced by the Handlebars templates of
+// the package rooted at root against those declared in its manifests.
+//
+// Data stream templates in integration packages may reference the package
+// variables, the variables of policy template inputs of the same type as
+// the stream, and the variables of the stream. Input package templates may
+// reference the package variables and the variables of the policy templates
+// using them. Variables referenced by a template that are not declared are
+// reported as undefined, and declared variables that are not referenced by
+// any template that may reference them are reported as unused. Templates
+// that do not exist are not checked.
+func CheckVars(root string) ([]VarIssue, error) {
+	pkg, err := readVarManifest(root, "manifest.yml")
+	if err != nil {
+		return nil, err
+	}
+	c := varChecker{root: root, refs: make(map[string][]varRef)}
+	switch pkg.Type {
+	case "integration":
+		dirs, err := filepath.Glob(filepath.Join(root, "data_stream", "*", "manifest.yml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range dirs {
+			ds := path.Join("data_stream", filepath.Base(filepath.Dir(p)))
+			m, err := readVarManifest(root, path.Join(ds, "manifest.yml"))
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range m.Streams {
+				tmpl := s.TemplatePath
+				if tmpl == "" {
+					tmpl = "stream.yml.hbs"
+				}
+				tmpl = path.Join(ds, "agent", "stream", tmpl)
+				ok, err := c.template(tmpl)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					continue
+				}
+				c.declare(tmpl, pkg.Vars)
+				for _, p := range pkg.PolicyTemplates {
+					for _, in := range p.Inputs {
+						if in.Type == s.Input {
+							c.declare(tmpl, in.Vars)
+						}
+					}
+				}
+				c.declare(tmpl, s.Vars)
+			}
+		}
+	case "input":
+		for _, p := range pkg.PolicyTemplates {
+			if p.TemplatePath == "" {
+				continue
+			}
+			tmpl := path.Join("agent", "input", p.TemplatePath)
+			ok, err := c.template(tmpl)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			c.declare(tmpl, pkg.Vars)
+			c.declare(tmpl, p.Vars)
+		}
+	}
+	return c.issues(), nil
+}
+
+// varChecker collects the variables declared for and referenced by the
+// templates of a package.
+type varChecker struct {
+	root string
+
+	// refs holds the references made by each
+	// template keyed by template path.
+	refs map[string][]varRef
+
+	// visible holds the set of templates that
+	// may reference each declaration.
+	visible map[*varDecl][]string
+
+	// decls holds the declarations in the
+	// order they are found.
+	decls []*varDecl
+}
+
+// template reads and records the references made by the template at the
+// package-relative path rel, returning whether it exists.
+func (c *varChecker) template(rel string) (ok bool, err error) {
+	if _, ok := c.refs[rel]; ok {
+		return true, nil
+	}
+	b, err := os.ReadFile(filepath.Join(c.root, filepath.FromSlash(rel)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	c.refs[rel] = templateRefs(string(b))
+	return true, nil
+}
+
+// declare records that the variables in decls may be referenced by the
+// template at the package-relative path tmpl.
+func (c *varChecker) declare(tmpl string, decls []*varDecl) {
+	if c.visible == nil {
+		c.visible = make(map[*varDecl][]string)
+	}
+	for _, d := range decls {
+		if _, ok := c.visible[d]; !ok {
+			c.decls = append(c.decls, d)
+		}
+		c.visible[d] = append(c.visible[d], tmpl)
+	}
+}
+
+// issues returns the undefined and unused variables found by c, ordered
+// by path and line.
+func (c *varChecker) issues() []VarIssue {
+	var issues []VarIssue
+	used := make(map[*varDecl]bool)
+	for tmpl, refs := range c.refs {
+		var decls []*varDecl
+		for _, d := range c.decls {
+			for _, t := range c.visible[d] {
+				if t == tmpl {
+					decls = append(decls, d)
+					break
+				}
+			}
+		}
+		for _, r := range refs {
+			var found bool
+			for _, d := range decls {
+				if r.name == d.Name || strings.HasPrefix(r.name, d.Name+".") {
+					used[d] = true
+					found = true
+				}
+			}
+			if !found {
+				issues = append(issues, VarIssue{Path: tmpl, Line: r.line, Name: r.name, Undefined: true})
+			}
+		}
+	}
+	for _, d := range c.decls {
+		if !used[d] && !fleetVars[d.Name] {
+			issues = append(issues, VarIssue{Path: d.path, Line: d.line, Name: d.Name})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		switch {
+		case issues[i].Path != issues[j].Path:
+			return issues[i].Path < issues[j].Path
+		case issues[i].Line != issues[j].Line:
+			return issues[i].Line < issues[j].Line
+		default:
+			return issues[i].Name < issues[j].Name
+		}
+	})
+	return issues
+}
+
+// fleetVars is the set of variables that are used by Fleet rather than
+// referenced by templates.
+var fleetVars = map[string]bool{
+	"data_stream.dataset": true,
+}
+
+// varManifest holds the variable declarations of a package or data stream
+// manifest.
+type varManifest struct {
+	Type            string     `yaml:"type"`
+	Vars            []*varDecl `yaml:"vars"`
+	PolicyTemplates []struct {
+		TemplatePath string     `yaml:"template_path"`
+		Vars         []*varDecl `yaml:"vars"`
+		Inputs       []struct {
+			Type string     `yaml:"type"`
+			Vars []*varDecl `yaml:"vars"`
+		} `yaml:"inputs"`
+	} `yaml:"policy_templates"`
+	Streams []struct {
+		Input        string     `yaml:"input"`
+		TemplatePath string     `yaml:"template_path"`
+		Vars         []*varDecl `yaml:"vars"`
+	} `yaml:"streams"`
+}
+
+// varDecl is a variable declaration.
+type varDecl struct {
+	Name string `yaml:"name"`
+
+	// path and line are the slash-separated
+	// package-relative path of the declaring
+	// manifest and the line of the declaration.
+	path string
+	line int
+}
+
+// readVarManifest returns the variable declarations in the manifest at
+// the package-relative path rel in the package rooted at root.
+func readVarManifest(root, rel string) (*varManifest, error) {
+	b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	var m varManifest
+	err = yaml.Unmarshal(b, &m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	f, err := parser.ParseBytes(b, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rel, err)
+	}
+	locate := func(decls []*varDecl, prefix string) {
+		for i, d := range decls {
+			d.path = rel
+			d.line = lineOf(f, fmt.Sprintf("%s.vars[%d].name", prefix, i))
+		}
+	}
+	locate(m.Vars, "$")
+	for i, p := range m.PolicyTemplates {
+		locate(p.Vars, fmt.Sprintf("$.policy_templates[%d]", i))
+		for j, in := range p.Inputs {
+			locate(in.Vars, fmt.Sprintf("$.policy_templates[%d].inputs[%d]", i, j))
+		}
+	}
+	for i, s := range m.Streams {
+		locate(s.Vars, fmt.Sprintf("$.streams[%d]", i))
+	}
+	return &m, nil
+}
+
+// lineOf returns the line of the node at the YAML path p in f, or zero
+// if it is not found.
+func lineOf(f *ast.File, p string) int {
+	path, err := yaml.PathString(p)
+	if err != nil {
+		return 0
+	}
+	n, err := path.FilterFile(f)
+	if err != nil || n == nil || n.GetToken() == nil {
+		return 0
+	}
+	return n.GetToken().Position.Line
+}
+
+// varRef is a reference to a variable by a template.
+type varRef struct {
+	name string
+	line int
+}
+
+// templateHelpers is the set of Handlebars helpers available to Fleet
+// templates.
+var templateHelpers = map[string]bool{
+	"if":                      true,
+	"unless":                  true,
+	"each":                    true,
+	"with":                    true,
+	"lookup":                  true,
+	"log":                     true,
+	"else":                    true,
+	"contains":                true,
+	"escape_string":           true,
+	"escape_multiline_string": true,
+	"to_json":                 true,
+	"url_encode":              true,
+}
+
+var (
+	blockParams = regexp.MustCompile(`\bas\s+\|([^|]*)\|`)
+	exprTokens  = regexp.MustCompile(`"[^"]*"|'[^']*'|[^\s()]+`)
+	literal     = regexp.MustCompile(`^(["']|-?[0-9]|(true|false|null|undefined)$)`)
+)
+
+// templateRefs returns the variables referenced by the Handlebars template
+// src. Helper names, literals, data variables such as @index and block
+// parameters are not variable references.
+func templateRefs(src string) []varRef {
+	var (
+		refs  []varRef
+		scope []map[string]bool
+	)
+	for _, loc := range templateExpr.FindAllStringIndex(src, -1) {
+		line := strings.Count(src[:loc[0]], "\n") + 1
+		expr := strings.Trim(src[loc[0]:loc[1]], "{}")
+		expr = strings.TrimSpace(strings.Trim(expr, "~"))
+		if expr == "" {
+			continue
+		}
+		switch expr[0] {
+		case '!', '>':
+			// Comments and partials.
+			continue
+		case '/':
+			if len(scope) != 0 {
+				scope = scope[:len(scope)-1]
+			}
+			continue
+		case '#':
+			params := make(map[string]bool)
+			if m := blockParams.FindStringSubmatch(expr); m != nil {
+				for _, p := range strings.Fields(m[1]) {
+					params[p] = true
+				}
+				expr = strings.Replace(expr, m[0], "", 1)
+			}
+			scope = append(scope, params)
+			expr = expr[1:]
+		case '^', '&':
+			expr = expr[1:]
+		}
+	tokens:
+		for _, tok := range exprTokens.FindAllString(expr, -1) {
+			if literal.MatchString(tok) {
+				continue
+			}
+			if i := strings.Index(tok, "="); i >= 0 {
+				// Hash arguments.
+				tok = tok[i+1:]
+				if tok == "" || literal.MatchString(tok) {
+					continue
+				}
+			}
+			if tok[0] == '@' {
+				continue
+			}
+			for strings.HasPrefix(tok, "../") {
+				tok = tok[len("../"):]
+			}
+			tok = strings.TrimPrefix(tok, "./")
+			tok = strings.TrimPrefix(tok, "this.")
+			tok = strings.ReplaceAll(tok, "/", ".")
+			if tok == "this" || tok == "." || templateHelpers[tok] {
+				continue
+			}
+			first := tok
+			if i := strings.Index(tok, "."); i >= 0 {
+				first = tok[:i]
+			}
+			for _, params := range scope {
+				if params[first] {
+					continue tokens
+				}
+			}
+			refs = append(refs, varRef{name: tok, line: line})
+		}
+	}
+	return refs
+}
@@ -0,0 +1,123 @@
+package format
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var templateRefsTests = []struct {
+	name string
+	in   string
+	want []varRef
+}{
+	{
+		name: "variables",
+		in:   "host: \"{{host}}:{{port}}\"\npath: {{{path}}}\n",
+		want: []varRef{{name: "host", line: 1}, {name: "port", line: 1}, {name: "path", line: 2}},
+	},
+	{
+		name: "helpers",
+		in:   "{{#if enabled}}\n{{#contains \"forwarded\" tags}}\nkey: {{escape_string value}}\n{{/contains}}\n{{else if other}}\n{{/if}}\n",
+		want: []varRef{{name: "enabled", line: 1}, {name: "tags", line: 2}, {name: "value", line: 3}, {name: "other", line: 5}},
+	},
+	{
+		name: "block_params",
+		in:   "{{#each tags as |tag i|}}\n  - {{tag}}{{i}}{{@index}}\n{{/each}}\n{{tag}}\n",
+		want: []varRef{{name: "tags", line: 1}, {name: "tag", line: 4}},
+	},
+	{
+		name: "this",
+		in:   "{{#each paths}}\n  - {{this}}\n{{/each}}\n",
+		want: []varRef{{name: "paths", line: 1}},
+	},
+	{
+		name: "dotted",
+		in:   "{{data_stream.dataset}} {{../ssl.verification_mode}}\n",
+		want: []varRef{{name: "data_stream.dataset", line: 1}, {name: "ssl.verification_mode", line: 1}},
+	},
+	{
+		name: "comments",
+		in:   "{{!-- {{hidden}} --}}\n{{! note }}\n",
+		want: nil,
+	},
+}
+
+func TestTemplateRefs(t *testing.T) {
+	for _, test := range templateRefsTests {
+		t.Run(test.name, func(t *testing.T) {
+			got := templateRefs(test.in)
+			if !cmp.Equal(got, test.want, cmp.AllowUnexported(varRef{})) {
+				t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, test.want, cmp.AllowUnexported(varRef{})))
+			}
+		})
+	}
+}
+
+func TestCheckVars(t *testing.T) {
+	t.Run("integration", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "manifest.yml"), `name: pkg
+type: integration
+vars:
+  - name: proxy_url
+  - name: api_key
+policy_templates:
+  - name: pkg
+    inputs:
+      - type: udp
+        vars:
+          - name: udp_host
+      - type: logfile
+        vars:
+          - name: paths
+`)
+		write(t, filepath.Join(dir, "data_stream", "log", "manifest.yml"), `streams:
+  - input: udp
+    template_path: udp.yml.hbs
+    vars:
+      - name: tags
+      - name: unused
+  - input: logfile
+    vars:
+      - name: tags
+`)
+		write(t, filepath.Join(dir, "data_stream", "log", "agent", "stream", "udp.yml.hbs"), `host: "{{udp_host}}:{{udp_port}}"
+proxy: {{proxy_url}}
+tags:
+{{#each tags as |tag|}}
+  - {{tag}}
+{{/each}}
+`)
+		write(t, filepath.Join(dir, "data_stream", "log", "agent", "stream", "stream.yml.hbs"), `paths:
+{{#each paths}}
+  - {{this}}
+{{/each}}
+host: {{udp_host}}
+`)
+		got, err := CheckVars(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []VarIssue{
+			{Path: "data_stream/log/agent/stream/stream.yml.hbs", Line: 5, Name: "udp_host", Undefined: true},
+			{Path: "data_stream/log/agent/stream/udp.yml.hbs", Line: 1, Name: "udp_port", Undefined: true},
+			{Path: "data_stream/log/manifest.yml", Line: 6, Name: "unused"},
+			{Path: "data_stream/log/manifest.yml", Line: 9, Name: "tags"},
+			{Path: "manifest.yml", Line: 5, Name: "api_key"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+		}
+	})
+	t.Run("input", func(t *testing.T) {
+		got, err := CheckVars("testdata/input_pkg")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("unexpected issues: %v", got)
+		}
+	})
+}
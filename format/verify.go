@@ -0,0 +1,146 @@
+package format
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// decodeDocs returns the decoded values of the documents in file.
+// Documents without a body or holding only comments are skipped; the
+// parser yields one for a comment following the last document.
+func decodeDocs(file *ast.File) ([]interface{}, error) {
+	vals := make([]interface{}, 0, len(file.Docs))
+	for _, doc := range file.Docs {
+		switch doc.Body.(type) {
+		case nil, *ast.CommentGroupNode:
+			continue
+		}
+		ast.Walk(chompLiterals{}, doc.Body)
+		var v interface{}
+		err := yaml.NodeToValue(doc.Body, &v)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// chompLiterals is an ast.Visitor that corrects the decoded values of
+// block scalars with clip or strip chomping. The parser includes the blank
+// lines following such a scalar in its value, so the value would depend
+// on whether the next entry or item is preceded by a blank line. Only the
+// decoded value is altered; the scalar is printed from its source text.
+type chompLiterals struct{}
+
+func (v chompLiterals) Visit(n ast.Node) ast.Visitor {
+	lit, ok := n.(*ast.LiteralNode)
+	if !ok || lit.Value == nil || strings.Contains(lit.Start.Value, "+") {
+		return v
+	}
+	s := strings.TrimRight(lit.Value.Value, "\n")
+	if s != "" && !strings.Contains(lit.Start.Value, "-") {
+		s += "\n"
+	}
+	lit.Value.Value = s
+	return v
+}
+
+// checkEquivalent returns an error if the decoded data of the YAML
+// source in formatted differs from the decoded values in orig. Map key
+// order is ignored, and sequences at the paths in sortable may differ
+// in order. Paths in sortable have indices replaced with "[*]".
+func checkEquivalent(orig []interface{}, formatted string, sortable map[string]bool) error {
+	file, err := parser.ParseBytes([]byte(formatted), 0)
+	if err != nil {
+		return fmt.Errorf("formatted document is invalid: %w", err)
+	}
+	vals, err := decodeDocs(file)
+	if err != nil {
+		return fmt.Errorf("formatted document is invalid: %w", err)
+	}
+	if len(vals) != len(orig) {
+		return fmt.Errorf("number of documents changed from %d to %d", len(orig), len(vals))
+	}
+	for i := range orig {
+		path := equivalent(orig[i], vals[i], "$", sortable)
+		if path != "" {
+			return fmt.Errorf("formatting changes value at %s", path)
+		}
+	}
+	return nil
+}
+
+// equivalent returns the path of the first difference between a and b,
+// or the empty string if they are equivalent.
+func equivalent(a, b interface{}, path string, sortable map[string]bool) string {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			return path
+		}
+		keys := make([]string, 0, len(a))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			bv, ok := b[k]
+			if !ok {
+				return path + "." + k
+			}
+			av, ok := a[k]
+			if !ok {
+				return path + "." + k
+			}
+			if p := equivalent(av, bv, path+"."+k, sortable); p != "" {
+				return p
+			}
+		}
+		return ""
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return path
+		}
+		if !sortable[replaceIndices(path)] {
+			for i := range a {
+				if p := equivalent(a[i], b[i], fmt.Sprintf("%s[%d]", path, i), sortable); p != "" {
+					return p
+				}
+			}
+			return ""
+		}
+		// Find a distinct match in b for each element of a.
+		used := make([]bool, len(b))
+	outer:
+		for i := range a {
+			elem := fmt.Sprintf("%s[%d]", path, i)
+			for j := range b {
+				if !used[j] && equivalent(a[i], b[j], elem, sortable) == "" {
+					used[j] = true
+					continue outer
+				}
+			}
+			return elem
+		}
+		return ""
+	default:
+		if !reflect.DeepEqual(a, b) {
+			return path
+		}
+		return ""
+	}
+}
@@ -0,0 +1,131 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/token"
+)
+
+// stripAllQuotes is a Rule that unconditionally removes quotes.
+type stripAllQuotes struct{}
+
+func (v stripAllQuotes) Visitor(*Context) ast.Visitor { return v }
+
+func (v stripAllQuotes) Visit(n ast.Node) ast.Visitor {
+	if n, ok := n.(*ast.StringNode); ok {
+		n.Token.Type = token.StringType
+	}
+	return v
+}
+
+var equivalenceTests = []struct {
+	name     string
+	in       string
+	visitors []Rule
+	wantErr  string
+}{
+	{
+		name:     "canonical_quotes",
+		in:       "a: \"1.2\"\nb: 'string'\nc: \"@timestamp\"\n",
+		visitors: []Rule{CanonicalQuotes{}},
+	},
+	{
+		name:     "order",
+		in:       "b: 1\na: [1, 2]\n",
+		visitors: []Rule{CanonicalOrder{}},
+	},
+	{
+		name:     "sort_lists",
+		in:       "- name: b\n  fields:\n    - name: z\n    - name: y\n- name: a\n",
+		visitors: []Rule{SortLists{Less: LessByName}},
+	},
+	{
+		name:     "type_change",
+		in:       "a: \"1.2\"\n",
+		visitors: []Rule{stripAllQuotes{}},
+		wantErr:  "formatting changes value at $.a",
+	},
+	{
+		name:     "nested_type_change",
+		in:       "a:\n  - b: 'true'\n",
+		visitors: []Rule{stripAllQuotes{}},
+		wantErr:  "formatting changes value at $.a[0].b",
+	},
+	{
+		name:     "literal_before_blank_line",
+		in:       "a:\n  x: |\n    l1\n\n    l2\n\n  b: 2\n",
+		visitors: []Rule{CanonicalOrder{}},
+	},
+	{
+		name:     "literal_moved_from_blank_line",
+		in:       "processors:\n  - script:\n      source: |\n        a\n        b\n\n      lang: painless\n      tag: t\n",
+		visitors: []Rule{pipelineOrder},
+	},
+	{
+		name:     "literal_moved_to_blank_line",
+		in:       "b: |-\n  l1\nc: 1\n\na: >\n  l2\n",
+		visitors: []Rule{CanonicalOrder{}},
+	},
+	{
+		name:     "trailing_comment",
+		in:       "b: 1\na: 2\n# trailing\n",
+		visitors: []Rule{CanonicalQuotes{}, CanonicalOrder{}},
+	},
+	{
+		name:     "trailing_comment_document",
+		in:       "---\nb: 1\n---\na: 2\n# trailing\n",
+		visitors: []Rule{CanonicalOrder{}},
+	},
+}
+
+func TestEquivalence(t *testing.T) {
+	for _, test := range equivalenceTests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := applyChanges(test.name, []byte(test.in), test.visitors)
+			switch {
+			case err == nil && test.wantErr != "":
+				t.Errorf("expected error containing %q", test.wantErr)
+			case err != nil && test.wantErr == "":
+				t.Errorf("unexpected error: %v", err)
+			case err != nil && !strings.Contains(err.Error(), test.wantErr):
+				t.Errorf("unexpected error: got:%v want:%s", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	sortable := map[string]bool{"$.s": true}
+	for _, test := range []struct {
+		a, b interface{}
+		want string
+	}{
+		{
+			a:    map[string]interface{}{"s": []interface{}{"x", "y"}},
+			b:    map[string]interface{}{"s": []interface{}{"y", "x"}},
+			want: "",
+		},
+		{
+			a:    map[string]interface{}{"l": []interface{}{"x", "y"}},
+			b:    map[string]interface{}{"l": []interface{}{"y", "x"}},
+			want: "$.l[0]",
+		},
+		{
+			a:    map[string]interface{}{"s": []interface{}{"x", "x"}},
+			b:    map[string]interface{}{"s": []interface{}{"x", "y"}},
+			want: "$.s[1]",
+		},
+		{
+			a:    map[string]interface{}{"a": uint64(1)},
+			b:    map[string]interface{}{"b": uint64(1)},
+			want: "$.a",
+		},
+	} {
+		got := equivalent(test.a, test.b, "$", sortable)
+		if got != test.want {
+			t.Errorf("unexpected result for %v and %v: got:%q want:%q", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles returns the set of paths, relative to root, of files within
+// root that differ from the git revision rev, including untracked files.
+// Paths are in the form used by walk.
+func changedFiles(root, rev string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", "-z", rev, "--"},
+		{"ls-files", "--others", "--exclude-standard", "-z"},
+	} {
+		out, err := git(root, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range strings.Split(out, "\x00") {
+			if p != "" {
+				files[filepath.FromSlash(p)] = true
+			}
+		}
+	}
+	return files, nil
+}
+
+// git runs the git command with args in dir, returning its standard output.
+func git(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+	}
+	return stdout.String(), nil
+}
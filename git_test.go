@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "packages", "pkg")
+	for _, f := range []string{
+		"packages/pkg/manifest.yml",
+		"packages/pkg/changelog.yml",
+		"packages/other/manifest.yml",
+	} {
+		write(t, filepath.Join(dir, filepath.FromSlash(f)), "type: integration\n")
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		_, err := git(dir, args...)
+		if err != nil {
+			t.Fatalf("failed to set up repository: %v", err)
+		}
+	}
+
+	write(t, filepath.Join(pkg, "changelog.yml"), "- version: 0.1.0\n")
+	write(t, filepath.Join(pkg, "data_stream", "log", "manifest.yml"), "type: logs\n")
+	write(t, filepath.Join(dir, "packages", "other", "manifest.yml"), "type: input\n")
+
+	got, err := changedFiles(pkg, "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error getting changed files: %v", err)
+	}
+	want := map[string]bool{
+		"changelog.yml": true,
+		filepath.Join("data_stream", "log", "manifest.yml"): true,
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected result:\n--- got\n+++ want\n%s", cmp.Diff(got, want))
+	}
+
+	_, err = changedFiles(pkg, "no-such-revision")
+	if err == nil {
+		t.Error("expected error for invalid revision")
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		t.Fatalf("failed to make directory: %v", err)
+	}
+	err = os.WriteFile(path, []byte(data), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
@@ -1,25 +1,50 @@
-// The fumpt program formats the YAML source in a Fleet integration. It
+// The fumpt program formats the YAML source in a Fleet package. It
 // canonicalises YAML map field order and quote usage where possible.
 // In field definition files it orders field definitions lexically by
 // mapping name.
 //
 // Without an explicit path, it processes the package containing the
 // working directory, otherwise it processes the package containing
-// the directory of the command line argument.
+// the directory of the command line argument. If a command line
+// argument is a file, only that file is processed. Integration, input and
+// content packages are supported, each with their own conventions.
+// With -r, every package found within the command line argument
+// directories is processed.
+//
+// The formatting is implemented by the github.com/efd6/fumpt/format
+// package.
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/efd6/fumpt/format"
 )
 
 func main() {
 	write := flag.Bool("w", false, "write result to (source) files instead of stdout")
-	pipeline := flag.Bool("pipeline", false, "format pipeline")
+	check := flag.Bool("l", false, "list files whose formatting differs from fumpt's")
+	showDiff := flag.Bool("d", false, "display diffs instead of rewriting files")
+	stable := flag.Bool("verify", false, "display diffs of changes made by formatting the result a second time")
+	jsonReport := flag.Bool("json", false, "write a JSON report for each file instead of the formatted result")
+	pipeline := flag.Bool("pipeline", false, "also format data stream ingest pipelines")
+	jobs := flag.Int("j", runtime.GOMAXPROCS(0), "maximum number of files and packages formatted concurrently")
+	stdinPath := flag.String("path", "", "format standard input as the file at this package-relative path, writing to standard output")
+	var exclude patternList
+	flag.Var(&exclude, "exclude", "exclude files matching this gitignore-style package-relative pattern (may be repeated)")
+	since := flag.String("since", "", "only format files changed relative to this git revision and untracked files")
+	recursive := flag.Bool("r", false, "format all packages within the directories of the command line arguments")
+	checkVars := flag.Bool("vars", false, "check Handlebars template variables against manifest variables instead of formatting")
+	migrate := flag.Bool("migrate", false, "convert JSON ingest pipelines to YAML instead of formatting")
 	help := flag.Bool("h", false, "display help")
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
@@ -30,17 +55,124 @@ func main() {
 	if *help {
 		fmt.Fprintf(flag.CommandLine.Output(), `Usage of %s:
 
-The fumpt program formats the YAML source in a Fleet integration. It
+The fumpt program formats the YAML source in a Fleet package. It
 canonicalises YAML map field order and quote usage where possible.
 In field definition files it orders field definitions lexically by
 mapping name.
 
 Without an explicit path, it processes the package containing the
 working directory, otherwise it processes the package containing
-the directory of the command line argument.
+the directory of the command line argument. If a command line
+argument is a file, only that file is processed. Integration, input and
+content packages are supported, each with their own conventions.
+
+With -r, every package found within the command line argument
+directories is processed, for example all packages in an integrations
+repository, and a summary of the number of packages and files changed
+is written to standard error. Files and packages are formatted
+concurrently, bounded by -j, with output written in path order.
 
 By default the formatting is written to standard output as a txtar
-archive for inspection.
+archive for inspection. With -l, only the paths of files whose
+formatting differs from fumpt's are written, and with -d a unified
+diff of the changes to each file is written. In both cases the exit
+status is 1 if any file differs. The exit status is 2 if an error
+occurs. Files that cannot be formatted do not prevent other files
+from being processed, and all failures are reported at the end.
+
+With -verify, each file's formatted result is formatted a second
+time and a unified diff of any changes is written. The exit status
+is 1 if any file is changed by the second pass.
+
+With -path, the YAML source read from standard input is formatted as
+though it were the file at the given package-relative path, and the
+result is written to standard output. This is intended for editor
+integration. The conventions of the package containing the working
+directory are used, or the integration package conventions if the
+working directory is not in a package.
+
+With -json, a JSON object is written for each file reporting the
+package, path and class of the file, whether formatting changed it,
+the rules that made changes, and any error, including the line and
+column of syntax errors.
+
+Formatting is checked to ensure that the data in each file is not
+changed other than by map key reordering and list sorting. Files that
+would be changed are reported as errors and are not written.
+
+Conventions may be configured by a .fumpt.yml file in the package
+root or any of its parents up to the root of the repository. The
+nearest configuration file is used. The configuration may add,
+override or disable file classes, for example:
+
+	conventions:
+	  manifest.yml:
+	    quotes: preserve
+	    order:
+	      $.owner: 0
+	  _dev/build/build.yml:
+	    disable: true
+	  data_stream/*/fields/*.yml:
+	    sort_lists:
+	      by: name
+	      when: always
+	  kibana/dashboard/*.json:
+	    embedded_json:
+	      expand: true
+
+Files may be excluded from formatting by gitignore-style patterns in
+.fumptignore files in the package root or any of its parents up to the
+root of the repository, each relative to the directory holding the file,
+and by -exclude patterns relative to the package root, for example:
+
+	fumpt -exclude '_dev/deploy' -exclude 'data_stream/*/_dev/deploy'
+
+Data stream ingest pipelines, both YAML and JSON, are only formatted
+with -pipeline. When they are, quotes are canonicalised as for other
+YAML files, and the parameters of each processor are ordered with
+description and if first, then field, target_field and the options
+specific to the processor type, and finally ignore_missing,
+ignore_failure, tag and on_failure.
+
+JSON sample events, pipeline test expected results and ingest pipelines
+are written with four space indentation and a single trailing newline,
+with object members ordered by the same rules as YAML maps. In Kibana dashboards the
+JSON documents embedded as strings in panelsJSON, optionsJSON and
+searchSourceJSON are decoded, their object members sorted, and re-encoded
+as compact strings, giving stable diffs when dashboards are re-exported.
+The embedded documents may instead be expanded in place for review with
+the embedded_json configuration option "expand: true", as shown in the
+configuration example above.
+
+Handlebars templates of agent stream and input configuration are
+formatted by formatting the YAML fragments between lines holding
+template constructs such as {{#if}}, {{#each}} and {{variables}}, which
+are left unaltered. Quoted strings holding template expressions keep
+their quoting, and fragments that are not valid YAML on their own are
+left unaltered.
+
+With -vars, the variables referenced by each package's agent stream and
+input templates are checked against the variables declared at package,
+policy template and data stream level in its manifests instead of
+formatting. Undefined variables are reported with the template line
+referencing them and unused variables with the manifest line declaring
+them. The exit status is 1 if any are found.
+
+With -migrate, each package's data stream JSON ingest pipelines are
+converted to YAML files of the same name instead of formatting, and the
+paths of the converted pipelines are printed. Multi-line Painless
+scripts and conditions are written as literal block scalars and the
+ingest pipeline conventions are applied to the result. Pipeline
+processors in the data stream's other pipelines that name a converted
+pipeline are updated to name the YAML file.
+
+Formatting may be disabled for parts of a file by comment directives
+on the lines preceding a mapping entry or sequence item. A "# fumpt:ignore"
+directive leaves the entry or item unformatted. The rules to ignore may
+be named, for example "# fumpt:ignore order", using "quotes", "order"
+and "sort". A "# fumpt:off" directive leaves the entry or item and those
+following it in the same map or list unformatted until one preceded by
+a "# fumpt:on" directive, and the map or list is not reordered.
 
 BUG: Due to an issue in the underlying YAML library, maps with quoted
 keys must have quoted values. 
@@ -50,16 +182,123 @@ keys must have quoted values.
 		os.Exit(0)
 	}
 
-	if !*pipeline {
-		delete(conventions, "data_stream/*/elasticsearch/ingest_pipeline/*.yml")
+	m := format.Archive
+	var n int
+	for _, f := range []struct {
+		set  bool
+		mode format.Mode
+	}{
+		{set: *write, mode: format.Rewrite},
+		{set: *check, mode: format.List},
+		{set: *showDiff, mode: format.Diff},
+		{set: *stable, mode: format.Verify},
+		{set: *jsonReport, mode: format.Report},
+	} {
+		if f.set {
+			m = f.mode
+			n++
+		}
+	}
+	if n > 1 {
+		fmt.Fprintln(os.Stderr, "-w, -l, -d, -verify and -json are mutually exclusive")
+		flag.Usage()
+	}
+	if *jobs < 1 {
+		fmt.Fprintln(os.Stderr, "-j must be positive")
+		flag.Usage()
+	}
+
+	for _, p := range exclude {
+		err := format.CheckPattern(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+		}
+	}
+
+	if *checkVars && (n != 0 || *stdinPath != "" || *since != "") {
+		fmt.Fprintln(os.Stderr, "-vars cannot be used with -w, -l, -d, -verify, -json, -path or -since")
+		flag.Usage()
+	}
+	if *migrate && (n != 0 || *checkVars || *stdinPath != "" || *since != "") {
+		fmt.Fprintln(os.Stderr, "-migrate cannot be used with -w, -l, -d, -verify, -json, -vars, -path or -since")
+		flag.Usage()
+	}
+
+	if *stdinPath != "" {
+		if n != 0 || *recursive || *since != "" || flag.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "-path cannot be used with -w, -l, -d, -verify, -json, -r, -since or path arguments")
+			flag.Usage()
+		}
+		err := formatStdin(filepath.Clean(*stdinPath), format.Options{Pipeline: *pipeline, Exclude: exclude})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *stdinPath, err)
+			os.Exit(2)
+		}
+		return
 	}
 
+	var (
+		failed bool
+		total  format.Summary
+	)
 	paths := []string{"."}
-	if len(flag.Args()) > 1 {
-		paths = flag.Args()[1:]
+	if flag.NArg() != 0 {
+		paths = flag.Args()
+	}
+	var targets []*target
+	byRoot := make(map[string]*target)
+	addTarget := func(root, rel string) {
+		t, ok := byRoot[root]
+		if !ok {
+			t = &target{root: root}
+			if rel != "" {
+				t.files = make(map[string]bool)
+			}
+			byRoot[root] = t
+			targets = append(targets, t)
+		}
+		switch {
+		case rel == "":
+			t.files = nil
+		case t.files != nil:
+			t.files[rel] = true
+		}
 	}
 	for _, p := range paths {
-		r, err := root(p)
+		fi, err := os.Stat(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
+			failed = true
+			continue
+		}
+		if !fi.IsDir() {
+			r, rel, err := format.FileRoot(p)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					fmt.Fprintf(os.Stderr, "%s is not in a package\n", filepath.Clean(p))
+				} else {
+					fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
+				}
+				failed = true
+				continue
+			}
+			addTarget(r, rel)
+			continue
+		}
+		if *recursive {
+			roots, err := format.FindPackages(p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
+				failed = true
+				continue
+			}
+			for _, r := range roots {
+				addTarget(r, "")
+			}
+			continue
+		}
+		r, err := format.Root(p)
 		if err != nil {
 			switch {
 			case errors.Is(err, os.ErrNotExist):
@@ -71,16 +310,201 @@ keys must have quoted values.
 			default:
 				fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
 			}
+			failed = true
 			continue
 		}
+		addTarget(r, "")
+	}
 
-		var w io.Writer
-		if !*write {
-			w = os.Stdout
+	if *checkVars {
+		issues, err := checkTemplateVars(targets)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
+			os.Exit(2)
+		case failed:
+			os.Exit(2)
+		case issues:
+			os.Exit(1)
 		}
-		err = walk(r, w, conventions)
+		return
+	}
+
+	if *migrate {
+		if !migratePipelines(targets) || failed {
+			os.Exit(2)
+		}
+		return
+	}
+
+	// Format packages concurrently, collecting output so
+	// that it can be written in package order.
+	results := make([]struct {
+		out bytes.Buffer
+		sum format.Summary
+		err error
+	}, len(targets))
+	packages, files := format.NewPool(*jobs), format.NewPool(*jobs)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		i, t := i, t
+		wg.Add(1)
+		packages.Do(func() {
+			defer wg.Done()
+			res := &results[i]
+			include := t.include
+			if *since != "" {
+				changed, err := changedFiles(t.root, *since)
+				if err != nil {
+					res.err = err
+					return
+				}
+				include = func(rel string) bool {
+					return changed[rel] && t.include(rel)
+				}
+			}
+			res.sum, res.err = format.FormatPackage(t.root, format.Options{
+				Mode:     m,
+				Output:   &res.out,
+				Pipeline: *pipeline,
+				Exclude:  exclude,
+				Pool:     files,
+				Include:  include,
+			})
+		})
+	}
+	wg.Wait()
+	var errs format.FileErrors
+	for i, res := range results {
+		_, err := res.out.WriteTo(os.Stdout)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
+			failed = true
+		}
+		total.Add(res.sum)
+		if res.sum.Failed != 0 {
+			failed = true
 		}
+		if res.err != nil {
+			var fileErrs format.FileErrors
+			if errors.As(res.err, &fileErrs) {
+				errs = append(errs, fileErrs...)
+			} else {
+				errs = append(errs, fmt.Errorf("%s: %w", format.DisplayPath(targets[i].root), res.err))
+			}
+			failed = true
+		}
+	}
+	// Report all failures after the results.
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if *recursive {
+		fmt.Fprintln(os.Stderr, total)
+	}
+	switch {
+	case failed:
+		os.Exit(2)
+	case total.Changed != 0 && (m == format.List || m == format.Diff):
+		os.Exit(1)
+	case total.Unstable != 0:
+		os.Exit(1)
 	}
 }
+
+// target is a package to be formatted.
+type target struct {
+	root string
+
+	// files is the set of package-relative paths
+	// of the files to format. If files is nil, all
+	// files in the package are formatted.
+	files map[string]bool
+}
+
+// include returns whether the file at the package-relative path rel
+// should be formatted.
+func (t *target) include(rel string) bool {
+	return t.files == nil || t.files[rel]
+}
+
+// checkTemplateVars writes the template variable issues found in the
+// packages of targets to standard output, returning whether any were
+// found.
+func checkTemplateVars(targets []*target) (found bool, err error) {
+	for _, t := range targets {
+		issues, err := format.CheckVars(t.root)
+		if err != nil {
+			return found, fmt.Errorf("%s: %w", format.DisplayPath(t.root), err)
+		}
+		for _, i := range issues {
+			i.Path = filepath.Join(format.DisplayPath(t.root), filepath.FromSlash(i.Path))
+			fmt.Println(i)
+			found = true
+		}
+	}
+	return found, nil
+}
+
+// migratePipelines converts the JSON ingest pipelines of the packages of
+// targets to YAML, writing the paths of the converted pipelines to standard
+// output and errors to standard error. It returns whether all pipelines were
+// converted.
+func migratePipelines(targets []*target) (ok bool) {
+	ok = true
+	for _, t := range targets {
+		converted, err := format.MigratePipelines(t.root)
+		for _, p := range converted {
+			fmt.Println(filepath.Join(format.DisplayPath(t.root), filepath.FromSlash(p)))
+		}
+		if err != nil {
+			var fileErrs format.FileErrors
+			if errors.As(err, &fileErrs) {
+				for _, err := range fileErrs {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", format.DisplayPath(t.root), err)
+			}
+			ok = false
+		}
+	}
+	return ok
+}
+
+// formatStdin formats the YAML source read from standard input as the
+// file at the package-relative path rel, writing the result to standard
+// output. The conventions used are those of the package containing the
+// working directory, or the integration package conventions if the working
+// directory is not in a package.
+func formatStdin(rel string, opts format.Options) error {
+	r, err := format.Root(".")
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		r = ""
+	}
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	data, err := format.FormatPackageFile(r, rel, src, opts)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// patternList is a flag.Value holding a repeatable list of patterns.
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *patternList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}